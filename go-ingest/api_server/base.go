@@ -3,15 +3,21 @@ package api_server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"slices"
 	"strconv"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/zanmajeric/reporadar-go-ingest/config"
+	"github.com/zanmajeric/reporadar-go-ingest/embedder"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/indexer"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/ingest"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/jobs"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/repos"
 	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
 )
 
@@ -20,15 +26,27 @@ type Server struct {
 	router    *http.ServeMux
 	db        *pgxpool.Pool
 	searchSrv *search.Service
-	cfg       *config.AppConfig
+	ingestSrv *ingest.Service
+	registry  *repos.Registry
+	jobs      *jobs.Runner
+	// queryCaches are the query embedding caches by model, nil when disabled.
+	queryCaches map[string]*embedder.Cache
+	validators  map[string]*embedder.Validator
+	cfg         *config.AppConfig
 }
 
-func NewServer(cfg *config.AppConfig, db *pgxpool.Pool, searchSrv *search.Service) *Server {
+func NewServer(cfg *config.AppConfig, db *pgxpool.Pool, searchSrv *search.Service, ingestSrv *ingest.Service, registry *repos.Registry,
+	jobRunner *jobs.Runner, queryCaches map[string]*embedder.Cache, validators map[string]*embedder.Validator) *Server {
 	s := Server{
-		db:        db,
-		router:    http.NewServeMux(),
-		searchSrv: searchSrv,
-		cfg:       cfg,
+		db:          db,
+		router:      http.NewServeMux(),
+		searchSrv:   searchSrv,
+		ingestSrv:   ingestSrv,
+		registry:    registry,
+		jobs:        jobRunner,
+		queryCaches: queryCaches,
+		validators:  validators,
+		cfg:         cfg,
 	}
 	s.routes()
 	s.http = http.Server{
@@ -54,11 +72,19 @@ func (s *Server) Close(ctx context.Context) {
 
 func (s *Server) routes() {
 	s.router.HandleFunc("GET /health", s.handleHealth)
-	s.router.HandleFunc("POST /repos", s.handleRepo)
+	s.router.HandleFunc("POST /repos", s.handleCreateRepo)
+	s.router.HandleFunc("GET /repos", s.handleListRepos)
+	s.router.HandleFunc("GET /repos/{repo}", s.handleGetRepo)
+	s.router.HandleFunc("DELETE /repos/{repo}", s.handleDeleteRepo)
 	s.router.HandleFunc("POST /repos/{repo}/ingest", s.handleIngest)
+	s.router.HandleFunc("POST /repos/{repo}/reindex", s.handleReindex)
+	s.router.HandleFunc("POST /webhooks/github", s.handleGithubWebhook)
+	s.router.HandleFunc("GET /jobs/{id}", s.handleGetJob)
+	s.router.HandleFunc("DELETE /jobs/{id}", s.handleCancelJob)
 	s.router.HandleFunc("GET /issues", s.handleIssues)
 	s.router.HandleFunc("GET /search", s.handleSearch)
-	// TODO: add /repos, /repos/{id}/ingest, /issues, /search, /issues/{id}/duplicates
+	s.router.HandleFunc("GET /issues/{id}", s.handleGetIssue)
+	s.router.HandleFunc("GET /issues/{id}/duplicates", s.handleDuplicates)
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -66,31 +92,25 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	if err := s.db.Ping(r.Context()); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		_, _ = w.Write([]byte(fmt.Sprintf(`{"status":"error","error":"%v"}`, err)))
-		return
-	}
 	w.Header().Set("Content-Type", "application/json")
-	_, _ = w.Write([]byte(`{"status":"ok"}`))
-}
-
-func (s *Server) handleRepo(w http.ResponseWriter, r *http.Request) {
-	type Req struct {
-		Repo string `json:"repo"`
+	resp := map[string]any{"status": "ok"}
+	models := map[string]embedder.ValidatorStatus{}
+	for model, v := range s.validators {
+		models[model] = v.Status()
 	}
-
-	var req Req
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "json error: "+err.Error(), http.StatusBadRequest)
-		return
+	resp["embedding_models"] = models
+	if s.queryCaches != nil {
+		stats := map[string]embedder.CacheStats{}
+		for model, c := range s.queryCaches {
+			stats[model] = c.Stats()
+		}
+		resp["query_cache"] = stats
 	}
-	if req.Repo == "" {
-		http.Error(w, "repo required", http.StatusBadRequest)
-		return
+	if err := s.db.Ping(r.Context()); err != nil {
+		resp["status"], resp["error"] = "error", err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"status":"ok","repo":"` + req.Repo + `"}`))
+	_ = json.NewEncoder(w).Encode(resp)
 }
 
 func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
@@ -100,39 +120,64 @@ func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	registered, ok := s.lookupRepo(w, r, repo)
+	if !ok {
+		return
+	}
+
+	// The mock file can be loaded into any repo, other modes have to match the registered source.
 	mode := r.URL.Query().Get("mode")
-	if mode != "mock" {
-		http.Error(w, "only mode=mock is supported today", http.StatusBadRequest)
+	if mode == "" {
+		mode = registered.Source
+	}
+	if mode != "mock" && mode != registered.Source {
+		http.Error(w, "mode "+mode+" does not match repo source "+registered.Source, http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(s.ingestSrv.Modes(), mode) {
+		http.Error(w, fmt.Sprintf("%v: %q", ingest.ErrUnknownMode, mode), http.StatusBadRequest)
 		return
 	}
 
-	b, err := os.ReadFile("/Users/zmajeric/development/reporadar/data/mock_issues.json")
+	params := ingest.JobParams{
+		Mode: mode,
+		Full: r.URL.Query().Get("full") == "true",
+	}
+	job, err := s.jobs.Enqueue(r.Context(), ingest.JobKind, repo, params)
 	if err != nil {
-		http.Error(w, "mock file not found: "+err.Error(), http.StatusBadRequest)
+		http.Error(w, "failed to queue ingest: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	var issues []search.IssueRow
-	if err := json.Unmarshal(b, &issues); err != nil {
-		http.Error(w, "invalid json structure: "+err.Error(), http.StatusBadRequest)
-	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/jobs/%d", job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(job)
+}
 
-	//---- STORE INTO POSTGRES ----
-	ctx := r.Context()
+// handleReindex queues a job re-embedding the repo with the `model` query parameter, the active model by default.
+// The repo is searched with its current model until the job switches it over.
+func (s *Server) handleReindex(w http.ResponseWriter, r *http.Request) {
+	repo := r.PathValue("repo")
+	if _, ok := s.lookupRepo(w, r, repo); !ok {
+		return
+	}
+	model, err := s.searchSrv.ResolveModel(r.URL.Query().Get("model"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	for _, iss := range issues {
-		_, err := s.db.Exec(ctx,
-			`
-			INSERT INTO issues (id, repo, title, body, labels, created_at, updated_at)
-	        VALUES ($1,$2,$3,$4,$5,$6,$7)
-	        ON CONFLICT (id) DO NOTHING
-	        `,
-			iss.ID, iss.Repo, iss.Title, iss.Body, iss.Labels, iss.CreatedAt, iss.UpdatedAt,
-		)
-		if err != nil {
-			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
+	job, err := s.jobs.Enqueue(r.Context(), indexer.ReindexJobKind, repo, indexer.ReindexParams{Model: model})
+	if err != nil {
+		http.Error(w, "failed to queue reindex: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/jobs/%d", job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(job)
 }
 
 func (s *Server) handleIssues(w http.ResponseWriter, r *http.Request) {
@@ -141,22 +186,40 @@ func (s *Server) handleIssues(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "repo required", http.StatusBadRequest)
 		return
 	}
+	if _, ok := s.lookupRepo(w, r, repo); !ok {
+		return
+	}
+	filter, ok := parseFilter(w, r)
+	if !ok {
+		return
+	}
 
-	rows, err := s.db.Query(r.Context(), "SELECT id, title, body, labels, created_at FROM issues WHERE repo=$1 ORDER BY created_at", repo)
+	sort, order, err := search.ParseSort(r.URL.Query().Get("sort"), r.URL.Query().Get("order"))
 	if err != nil {
-		http.Error(w, "Db error: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
-
-	var out []search.IssueRow
-	for rows.Next() {
-		var iss search.IssueRow
-		if err := rows.Scan(&iss.ID, &iss.Title, &iss.Body, &iss.Labels, &iss.CreatedAt); err != nil {
-			http.Error(w, "Db error: "+err.Error(), http.StatusInternalServerError)
+	limit, ok := parsePageLimit(w, r, 50, 200)
+	if !ok {
+		return
+	}
+	page := search.Page{
+		Limit: limit,
+		Sort:  sort,
+		Order: order,
+	}
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		page.Cursor, err = search.DecodeCursor(c, sort, order)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		out = append(out, iss)
+	}
+
+	out, err := s.searchSrv.ListIssues(r.Context(), repo, filter, page)
+	if err != nil {
+		http.Error(w, "Db error: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -172,6 +235,10 @@ func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "repo is required", http.StatusBadRequest)
 		return
 	}
+	registered, ok := s.lookupRepo(w, r, repo)
+	if !ok {
+		return
+	}
 
 	searchQuery := r.URL.Query().Get("q")
 	if searchQuery == "" {
@@ -179,17 +246,35 @@ func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	limit := 10
-	if ls := r.URL.Query().Get("limit"); ls != "" {
-		if l, err := strconv.Atoi(ls); err == nil && l > 0 && l <= 20 {
-			limit = l
-		}
+	limit := parseLimit(r, 10, 20)
+
+	mode, err := search.ParseMode(r.URL.Query().Get("mode"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, ok := parseFilter(w, r)
+	if !ok {
+		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
 	defer cancel()
 
-	found, err := s.searchSrv.Search(ctx, repo, searchQuery, limit)
+	thresholds := registered.Settings.Thresholds(s.searchSrv.DefaultThresholds())
+	found, err := s.searchSrv.Search(ctx, search.Query{
+		Repo:       repo,
+		Model:      registered.EmbeddingModel,
+		Text:       searchQuery,
+		Limit:      limit,
+		Mode:       mode,
+		Filter:     filter,
+		Thresholds: &thresholds,
+	})
+	if errors.Is(err, search.ErrEmbedderUnavailable) {
+		http.Error(w, "embedder unavailable, retry later or use mode=lexical: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -198,13 +283,15 @@ func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	resp := struct {
 		Results      []search.Result `json:"results"`
+		Mode         search.Mode     `json:"mode"`
 		Message      string          `json:"message"`
 		StrongSimThr float64         `json:"strong_sim_thr"`
 		WeakSimThr   float64         `json:"weak_sim_thr"`
 	}{
 		Results:      found,
-		StrongSimThr: s.cfg.StrongSimThr,
-		WeakSimThr:   s.cfg.WeakSimThr,
+		Mode:         mode,
+		StrongSimThr: thresholds.Strong,
+		WeakSimThr:   thresholds.Weak,
 	}
 	if len(found) == 0 {
 		resp.Message = "no sufficiently similar issues found"
@@ -218,3 +305,117 @@ func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 	reqTime := time.Since(start)
 	log.Printf("[/search] request time: %v", reqTime)
 }
+
+// handleGetIssue returns a stored issue with its normalized body and linked pull requests.
+func (s *Server) handleGetIssue(w http.ResponseWriter, r *http.Request) {
+	issue, err := s.searchSrv.GetIssue(r.Context(), r.PathValue("id"))
+	if errors.Is(err, search.ErrIssueNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(issue)
+}
+
+func (s *Server) handleDuplicates(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	id := r.PathValue("id")
+	issue, err := s.searchSrv.GetIssue(r.Context(), id)
+	if errors.Is(err, search.ErrIssueNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	registered, ok := s.lookupRepo(w, r, issue.Repo)
+	if !ok {
+		return
+	}
+	filter, ok := parseFilter(w, r)
+	if !ok {
+		return
+	}
+
+	thresholds := registered.Settings.Thresholds(s.searchSrv.DefaultThresholds())
+	found, err := s.searchSrv.Duplicates(r.Context(), issue, search.Query{
+		Repo:       issue.Repo,
+		Limit:      parseLimit(r, 10, 20),
+		Filter:     filter,
+		Thresholds: &thresholds,
+	})
+	if errors.Is(err, search.ErrNoEmbedding) {
+		http.Error(w, fmt.Sprintf("issue %s has no embedding yet, retry once it has been embedded", id), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	resp := struct {
+		Issue        search.IssueRow `json:"issue"`
+		Results      []search.Result `json:"results"`
+		Message      string          `json:"message"`
+		StrongSimThr float64         `json:"strong_sim_thr"`
+		WeakSimThr   float64         `json:"weak_sim_thr"`
+	}{
+		Issue:        issue,
+		Results:      found,
+		StrongSimThr: thresholds.Strong,
+		WeakSimThr:   thresholds.Weak,
+	}
+	if len(found) == 0 {
+		resp.Message = "no duplicate candidates found"
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "failed serializing response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[/issues/{id}/duplicates] request time: %v", time.Since(start))
+}
+
+// parseLimit reads the `limit` query parameter, falling back to def when it is missing or not within (0, max].
+func parseLimit(r *http.Request, def, max int) int {
+	if ls := r.URL.Query().Get("limit"); ls != "" {
+		if l, err := strconv.Atoi(ls); err == nil && l > 0 && l <= max {
+			return l
+		}
+	}
+	return def
+}
+
+// parsePageLimit reads the `limit` of a paginated listing, def when it is missing. A limit that is no number or not
+// within (0, max] writes a 400 response and returns false.
+func parsePageLimit(w http.ResponseWriter, r *http.Request, def, max int) (int, bool) {
+	ls := r.URL.Query().Get("limit")
+	if ls == "" {
+		return def, true
+	}
+	l, err := strconv.Atoi(ls)
+	if err != nil || l <= 0 || l > max {
+		http.Error(w, fmt.Sprintf("invalid limit %q, expected a number from 1 to %d", ls, max), http.StatusBadRequest)
+		return 0, false
+	}
+	return l, true
+}
+
+// parseFilter reads the structured search filters, writing a 400 response listing the malformed parameters and
+// returning false when that fails.
+func parseFilter(w http.ResponseWriter, r *http.Request) (search.Filter, bool) {
+	filter, err := search.ParseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return filter, false
+	}
+	return filter, true
+}
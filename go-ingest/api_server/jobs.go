@@ -0,0 +1,47 @@
+package api_server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/jobs"
+)
+
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
+	job, err := s.jobs.Get(r.Context(), id)
+	writeJob(w, job, err)
+}
+
+// handleCancelJob cancels a queued job immediately, a running job is stopped by its worker shortly after.
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
+	job, err := s.jobs.Cancel(r.Context(), id)
+	writeJob(w, job, err)
+}
+
+func writeJob(w http.ResponseWriter, job jobs.Job, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, jobs.ErrFinished):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(job)
+}
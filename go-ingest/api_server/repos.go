@@ -0,0 +1,107 @@
+package api_server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/repos"
+)
+
+func (s *Server) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
+	type Req struct {
+		Repo     string         `json:"repo"`
+		Source   string         `json:"source"`
+		Settings repos.Settings `json:"settings"`
+		// WebhookSecret is required to accept GitHub webhook deliveries for the repo.
+		WebhookSecret string `json:"webhook_secret"`
+	}
+
+	var req Req
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "json error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Repo == "" {
+		http.Error(w, "repo required", http.StatusBadRequest)
+		return
+	}
+	if req.Source == "" {
+		req.Source = "github"
+	}
+
+	repo, err := s.registry.Create(r.Context(), repos.Repo{
+		Name:          req.Repo,
+		Source:        req.Source,
+		Settings:      req.Settings,
+		WebhookSecret: req.WebhookSecret,
+	})
+	if errors.Is(err, repos.ErrExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(repo)
+}
+
+func (s *Server) handleListRepos(w http.ResponseWriter, r *http.Request) {
+	list, err := s.registry.List(r.Context())
+	if err != nil {
+		http.Error(w, "Db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+func (s *Server) handleGetRepo(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("repo")
+	repo, err := s.registry.Get(r.Context(), name)
+	if !repoFound(w, err, name) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(repo)
+}
+
+func (s *Server) handleDeleteRepo(w http.ResponseWriter, r *http.Request) {
+	err := s.registry.Delete(r.Context(), r.PathValue("repo"))
+	if errors.Is(err, repos.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, repos.ErrBusy) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookupRepo resolves a registered repo, writing a 404 (or 500) response and returning false when that fails.
+func (s *Server) lookupRepo(w http.ResponseWriter, r *http.Request, name string) (repos.Repo, bool) {
+	repo, err := s.registry.Lookup(r.Context(), name)
+	return repo, repoFound(w, err, name)
+}
+
+// repoFound writes the response for an error resolving a repo and reports whether there was none.
+func repoFound(w http.ResponseWriter, err error, name string) bool {
+	if errors.Is(err, repos.ErrNotFound) {
+		http.Error(w, err.Error()+": "+name, http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "Db error: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
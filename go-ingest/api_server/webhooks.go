@@ -0,0 +1,69 @@
+package api_server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/ingest"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/repos"
+)
+
+// maxWebhookPayload is the largest payload GitHub delivers.
+const maxWebhookPayload = 25 << 20
+
+func (s *Server) handleGithubWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		http.Error(w, "failed reading payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	event := r.Header.Get("X-GitHub-Event")
+	deliveryID := r.Header.Get("X-GitHub-Delivery")
+	if event == "" || deliveryID == "" {
+		http.Error(w, "X-GitHub-Event and X-GitHub-Delivery headers required", http.StatusBadRequest)
+		return
+	}
+
+	repoName, err := ingest.WebhookRepo(payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Unknown repos, repos without a secret and bad signatures are answered alike, so the endpoint does not tell
+	// which repos are registered.
+	repo, err := s.registry.Lookup(r.Context(), repoName)
+	if err != nil && !errors.Is(err, repos.ErrNotFound) {
+		http.Error(w, "Db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err != nil || !repo.HasWebhookSecret ||
+		!ingest.VerifyGithubSignature(repo.WebhookSecret, payload, r.Header.Get("X-Hub-Signature-256")) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	applied := false
+	if event == "issues" {
+		applied, err = s.ingestSrv.HandleGithubIssueEvent(r.Context(), deliveryID, payload)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		Status   string `json:"status"`
+		Event    string `json:"event"`
+		Delivery string `json:"delivery"`
+		Applied  bool   `json:"applied"`
+	}{
+		Status:   "ok",
+		Event:    event,
+		Delivery: deliveryID,
+		Applied:  applied,
+	})
+}
@@ -14,13 +14,72 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// EmbeddingModelConfig configures an embedder besides the one of the Embedder* fields, see AppConfig.EmbeddingModels.
+type EmbeddingModelConfig struct {
+	Id     string `yaml:"Id"`
+	Kind   string `yaml:"Kind"`
+	Url    string `yaml:"Url"`
+	Model  string `yaml:"Model"`
+	ApiKey string `yaml:"ApiKey"`
+	// Dim is the dimension of the model's vectors, 0 to learn it from the embedder at startup.
+	Dim int `yaml:"Dim"`
+}
+
 type AppConfig struct {
-	HttpPort           int           `yaml:"HttpPort"`
-	DatabaseUrl        string        `yaml:"DatabaseUrl"`
-	EmbedderUrl        string        `yaml:"EmbedderUrl"`
-	EmbedderReqTimeout time.Duration `yaml:"EmbedderReqTimeout"`
-	StrongSimThr       float64       `yaml:"StrongSimThr"`
-	WeakSimThr         float64       `yaml:"WeakSimThr"`
+	HttpPort                 int           `yaml:"HttpPort"`
+	DatabaseUrl              string        `yaml:"DatabaseUrl"`
+	EmbedderKind             string        `yaml:"EmbedderKind" default:"reporadar"`
+	EmbedderUrl              string        `yaml:"EmbedderUrl"`
+	EmbedderModel            string        `yaml:"EmbedderModel"`
+	EmbedderApiKey           string        `yaml:"EmbedderApiKey"`
+	EmbedderReqTimeout       time.Duration `yaml:"EmbedderReqTimeout"`
+	EmbedderMaxBatch         int           `yaml:"EmbedderMaxBatch" default:"32"`
+	EmbedderRetries          *int          `yaml:"EmbedderRetries"`
+	EmbedderRetryDelay       time.Duration `yaml:"EmbedderRetryDelay" default:"200ms"`
+	EmbedderMaxRetryDelay    time.Duration `yaml:"EmbedderMaxRetryDelay" default:"2s"`
+	EmbedderBreakerThreshold *int          `yaml:"EmbedderBreakerThreshold"`
+	EmbedderBreakerCooldown  time.Duration `yaml:"EmbedderBreakerCooldown" default:"30s"`
+	DisableQueryCache        bool          `yaml:"DisableQueryCache"`
+	QueryCacheSize           int           `yaml:"QueryCacheSize" default:"1000"`
+	QueryCacheTTL            time.Duration `yaml:"QueryCacheTTL" default:"24h"`
+	QueryCachePersist        bool          `yaml:"QueryCachePersist"`
+	StrongSimThr             float64       `yaml:"StrongSimThr"`
+	WeakSimThr               float64       `yaml:"WeakSimThr"`
+	MockIssuesFile           string        `yaml:"MockIssuesFile" default:"../data/mock_issues.json"`
+	GithubApiUrl             string        `yaml:"GithubApiUrl" default:"https://api.github.com"`
+	GithubToken              string        `yaml:"GithubToken"`
+	GithubTimelineLimit      int           `yaml:"GithubTimelineLimit"`
+	GitlabUrl                string        `yaml:"GitlabUrl" default:"https://gitlab.com"`
+	GitlabToken              string        `yaml:"GitlabToken"`
+	JiraUrl                  string        `yaml:"JiraUrl"`
+	JiraCloud                bool          `yaml:"JiraCloud"`
+	JiraUser                 string        `yaml:"JiraUser"`
+	JiraToken                string        `yaml:"JiraToken"`
+	JobWorkers               int           `yaml:"JobWorkers" default:"2"`
+	JobPollInterval          time.Duration `yaml:"JobPollInterval" default:"1s"`
+	DisableEmbedWorker       bool          `yaml:"DisableEmbedWorker"`
+	EmbedBatchSize           int           `yaml:"EmbedBatchSize" default:"16"`
+	EmbedPollInterval        time.Duration `yaml:"EmbedPollInterval" default:"5s"`
+	EmbedMaxAttempts         int           `yaml:"EmbedMaxAttempts" default:"5"`
+	EmbedLease               time.Duration `yaml:"EmbedLease" default:"2m"`
+	EmbedRetryBackoff        time.Duration `yaml:"EmbedRetryBackoff" default:"30s"`
+	ChunkMaxChars            int           `yaml:"ChunkMaxChars" default:"1000"`
+	ChunkAggregation         string        `yaml:"ChunkAggregation" default:"max"`
+	ChunkTopK                int           `yaml:"ChunkTopK" default:"3"`
+	DisableTextNorm          bool          `yaml:"DisableTextNorm"`
+	TextNormLogHead          int           `yaml:"TextNormLogHead" default:"20"`
+	TextNormLogTail          int           `yaml:"TextNormLogTail" default:"30"`
+	CommentEmbedding         string        `yaml:"CommentEmbedding" default:"separate"`
+	// EmbeddingDim is the dimension of the active model, 0 to learn it from the embedder at startup.
+	EmbeddingDim int `yaml:"EmbeddingDim"`
+	// EmbeddingModelId names the active model configured by the Embedder* fields, it is derived from them when empty.
+	EmbeddingModelId string `yaml:"EmbeddingModelId"`
+	// EmbeddingModels are further models, e.g. the previous model that repos are searched with until re-indexed.
+	EmbeddingModels []EmbeddingModelConfig `yaml:"EmbeddingModels"`
+	// TextNormSteps are the text normalization steps applied to issue bodies before embedding, all when empty.
+	TextNormSteps []string `yaml:"TextNormSteps"`
+	// TextNormBoilerplate are regular expressions of further lines to strip, e.g. the lines of the repo's templates.
+	TextNormBoilerplate []string `yaml:"TextNormBoilerplate"`
 }
 
 func LoadConfig(configFiles []string) *AppConfig {
@@ -29,6 +88,7 @@ func LoadConfig(configFiles []string) *AppConfig {
 	if err != nil {
 		log.Panic("error loading configuration:", err)
 	}
+	SetDefaultsConfiguration(&configuration)
 	return &configuration
 }
 
@@ -1,18 +1,22 @@
 package embedder
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 )
 
+// DefaultBatchSize is the number of texts sent per /embed/batch request unless configured otherwise.
+const DefaultBatchSize = 32
+
 type Client struct {
 	BaseURL    string
 	HTTPClient *http.Client
+	// BatchSize is the maximum number of texts per /embed/batch request, larger batches are split.
+	BatchSize int
+	Policy    *Policy
 }
 
 func NewClient(baseURL string) *Client {
@@ -21,6 +25,7 @@ func NewClient(baseURL string) *Client {
 		HTTPClient: &http.Client{
 			Timeout: 5 * time.Second,
 		},
+		BatchSize: DefaultBatchSize,
 	}
 }
 
@@ -30,35 +35,22 @@ type embedRequest struct {
 type embedResponse struct {
 	Embedding []float32 `json:"embedding"`
 }
+type embedBatchRequest struct {
+	Texts []string `json:"texts"`
+}
+
+// embedBatchResponse holds one embedding per text, failed items have a null embedding and an error message.
+type embedBatchResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+	Errors     []*string   `json:"errors"`
+}
 
 func (c *Client) Embed(ctx context.Context, text string) ([]float32, error) {
 	embedderStartTime := time.Now()
 
-	body, err := json.Marshal(embedRequest{Text: text})
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal embedRequest: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/embed", bytes.NewReader(body)) // TODO: unsupported protocol scheme => fix the baseUrl
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
 	var er embedResponse
-	if err := json.NewDecoder(resp.Body).Decode(&er); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := c.post(ctx, "/embed", embedRequest{Text: text}, &er); err != nil {
+		return nil, err
 	}
 
 	if len(er.Embedding) == 0 {
@@ -69,3 +61,39 @@ func (c *Client) Embed(ctx context.Context, text string) ([]float32, error) {
 
 	return er.Embedding, nil
 }
+
+// EmbedBatch embeds texts through /embed/batch, in requests of at most BatchSize texts. A failed request fails all
+// of its items, the remaining requests are still sent.
+func (c *Client) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	return embedInChunks(ctx, texts, c.BatchSize, c.embedChunk)
+}
+
+// embedChunk sends a single /embed/batch request and returns a vector or an error for every text.
+func (c *Client) embedChunk(ctx context.Context, texts []string) ([][]float32, []error) {
+	var br embedBatchResponse
+	if err := c.post(ctx, "/embed/batch", embedBatchRequest{Texts: texts}, &br); err != nil {
+		return failAll(len(texts), err)
+	}
+	if len(br.Embeddings) != len(texts) {
+		return failAll(len(texts), fmt.Errorf("expected %d embeddings, got %d", len(texts), len(br.Embeddings)))
+	}
+	vecs := make([][]float32, len(texts))
+	errs := make([]error, len(texts))
+	for i, emb := range br.Embeddings {
+		switch {
+		case i < len(br.Errors) && br.Errors[i] != nil:
+			errs[i] = fmt.Errorf("embedder: %s", *br.Errors[i])
+		case len(emb) == 0:
+			errs[i] = fmt.Errorf("empty embedding")
+		default:
+			vecs[i] = emb
+		}
+	}
+	return vecs, errs
+}
+
+func (c *Client) post(ctx context.Context, path string, payload any, target any) error {
+	return c.Policy.Do(ctx, func(ctx context.Context) error {
+		return postJSON(ctx, c.HTTPClient, c.BaseURL+path, nil, payload, target) // TODO: unsupported protocol scheme => fix the baseUrl
+	})
+}
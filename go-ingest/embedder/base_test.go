@@ -0,0 +1,96 @@
+package embedder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+func TestClient_EmbedBatchSplitsAndReportsFailedItems(t *testing.T) {
+	var sizes []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embed/batch" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var req embedBatchRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		sizes = append(sizes, len(req.Texts))
+
+		var resp embedBatchResponse
+		for _, text := range req.Texts {
+			if text == "" {
+				msg := "empty text"
+				resp.Embeddings = append(resp.Embeddings, nil)
+				resp.Errors = append(resp.Errors, &msg)
+				continue
+			}
+			resp.Embeddings = append(resp.Embeddings, []float32{float32(len(text))})
+			resp.Errors = append(resp.Errors, nil)
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	c.BatchSize = 2
+	vecs, err := c.EmbedBatch(context.Background(), []string{"a", "", "abc", "ab", "abcd"})
+
+	var batchErr *search.BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected a BatchError, got %v", err)
+	}
+	if len(batchErr.Errors) != 1 || batchErr.Errors[1] == nil {
+		t.Errorf("expected only item 1 to fail, got %v", batchErr.Errors)
+	}
+	if len(sizes) != 3 || sizes[0] != 2 || sizes[2] != 1 {
+		t.Errorf("expected requests of 2, 2 and 1 texts, got %v", sizes)
+	}
+	want := []float32{1, 0, 3, 2, 4}
+	for i, v := range vecs {
+		if i == 1 {
+			if v != nil {
+				t.Errorf("expected no vector for the failed item, got %v", v)
+			}
+			continue
+		}
+		if len(v) != 1 || v[0] != want[i] {
+			t.Errorf("item %d: expected [%v], got %v", i, want[i], v)
+		}
+	}
+}
+
+func TestClient_EmbedBatchFailsItemsOfFailedRequest(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(embedBatchResponse{
+			Embeddings: [][]float32{{1}},
+			Errors:     []*string{nil},
+		})
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	c.BatchSize = 2
+	vecs, err := c.EmbedBatch(context.Background(), []string{"a", "b", "c"})
+
+	var batchErr *search.BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected a BatchError, got %v", err)
+	}
+	if len(batchErr.Errors) != 2 || batchErr.Errors[0] == nil || batchErr.Errors[1] == nil {
+		t.Errorf("expected the first request's items to fail, got %v", batchErr.Errors)
+	}
+	if len(vecs[2]) != 1 {
+		t.Errorf("expected item 2 to be embedded, got %v", vecs[2])
+	}
+}
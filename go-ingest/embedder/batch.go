@@ -0,0 +1,89 @@
+package embedder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+// chunkFunc embeds one chunk of a batch, returning a vector or an error for every text.
+type chunkFunc func(ctx context.Context, texts []string) ([][]float32, []error)
+
+// embedInChunks splits texts into chunks of at most size texts and embeds them in order. Failed items are reported
+// with a *search.BatchError next to the vectors of the others.
+func embedInChunks(ctx context.Context, texts []string, size int, embed chunkFunc) ([][]float32, error) {
+	embedderStartTime := time.Now()
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+
+	out := make([][]float32, len(texts))
+	failed := map[int]error{}
+	for start := 0; start < len(texts); start += size {
+		end := min(start+size, len(texts))
+		vecs, errs := embed(ctx, texts[start:end])
+		for i := range vecs {
+			if errs[i] != nil {
+				failed[start+i] = errs[i]
+				continue
+			}
+			out[start+i] = vecs[i]
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	log.Printf("batch embedding time: %v texts=%d failed=%d", time.Since(embedderStartTime), len(texts), len(failed))
+
+	if len(failed) > 0 {
+		return out, &search.BatchError{Errors: failed}
+	}
+	return out, nil
+}
+
+// failAll reports err for every one of n items.
+func failAll(n int, err error) ([][]float32, []error) {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return make([][]float32, n), errs
+}
+
+// postJSON sends payload as JSON and decodes a 200 response into target, other responses fail with a *StatusError.
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, payload any, target any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newStatusError(resp)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package embedder
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+// CacheStore persists cached query embeddings, so they survive restarts and are shared between replicas.
+type CacheStore interface {
+	// Get returns the stored vector of an unexpired entry with its expiry.
+	Get(ctx context.Context, model, query string) ([]float32, time.Time, bool, error)
+	Put(ctx context.Context, model, query string, vector []float32, expiresAt time.Time) error
+	// Prune deletes the expired entries.
+	Prune(ctx context.Context) error
+}
+
+// CacheStats are the counters of a Cache since start.
+type CacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	Size   int   `json:"size"`
+}
+
+// Cache remembers the embeddings of search queries in a size- and TTL-bounded LRU, optionally backed by a Store.
+// Entries are keyed by model and normalized query text. EmbedBatch, used for indexing issues, is not cached.
+type Cache struct {
+	next  search.Embedder
+	model string
+	size  int
+	ttl   time.Duration
+	// Store is consulted on misses of the in-memory LRU, nil keeps the cache in memory only.
+	Store CacheStore
+
+	mu        sync.Mutex
+	entries   map[string]*list.Element
+	lru       *list.List
+	lastPrune time.Time
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type cacheEntry struct {
+	key       string
+	vector    []float32
+	expiresAt time.Time
+}
+
+func NewCache(next search.Embedder, model string, size int, ttl time.Duration) *Cache {
+	return &Cache{
+		next:      next,
+		model:     model,
+		size:      size,
+		ttl:       ttl,
+		entries:   map[string]*list.Element{},
+		lru:       list.New(),
+		lastPrune: time.Now(),
+	}
+}
+
+// NormalizeQuery makes queries differing only in case and whitespace share a cache entry.
+func NormalizeQuery(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+func (c *Cache) Embed(ctx context.Context, text string) ([]float32, error) {
+	query := NormalizeQuery(text)
+	if vec, ok := c.get(query); ok {
+		c.hits.Add(1)
+		return vec, nil
+	}
+	if c.Store != nil {
+		vec, expiresAt, ok, err := c.Store.Get(ctx, c.model, query)
+		if err != nil {
+			log.Printf("[query-cache] store lookup failed: %v", err)
+		}
+		if ok {
+			c.hits.Add(1)
+			c.put(query, vec, expiresAt)
+			return vec, nil
+		}
+	}
+	c.misses.Add(1)
+
+	vec, err := c.next.Embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(c.ttl)
+	c.put(query, vec, expiresAt)
+	if c.Store != nil {
+		if err := c.Store.Put(ctx, c.model, query, vec, expiresAt); err != nil {
+			log.Printf("[query-cache] store write failed: %v", err)
+		}
+		c.pruneStore(ctx)
+	}
+	return vec, nil
+}
+
+func (c *Cache) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	return c.next.EmbedBatch(ctx, texts)
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Size: size}
+}
+
+func (c *Cache) get(query string) ([]float32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[query]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.lru.Remove(el)
+		delete(c.entries, query)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return entry.vector, true
+}
+
+// put adds an entry expiring at expiresAt, or after the TTL of the cache when that comes first: an entry from the store
+// keeps the expiry it was stored with.
+func (c *Cache) put(query string, vec []float32, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if limit := time.Now().Add(c.ttl); expiresAt.After(limit) {
+		expiresAt = limit
+	}
+	entry := &cacheEntry{key: query, vector: vec, expiresAt: expiresAt}
+	if el, ok := c.entries[query]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[query] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// pruneStore deletes expired entries from the store at most once per TTL.
+func (c *Cache) pruneStore(ctx context.Context) {
+	c.mu.Lock()
+	due := time.Since(c.lastPrune) >= c.ttl
+	if due {
+		c.lastPrune = time.Now()
+	}
+	c.mu.Unlock()
+	if !due {
+		return
+	}
+	if err := c.Store.Prune(ctx); err != nil {
+		log.Printf("[query-cache] prune failed: %v", err)
+	}
+}
+
+// WithQueryCache wraps the embedder of every model in its own Cache, all sharing store when it is not nil.
+func WithQueryCache(models search.Models, size int, ttl time.Duration, store CacheStore) (search.Models, map[string]*Cache) {
+	cached := search.Models{Active: models.Active, Embedders: make(map[string]search.Embedder, len(models.Embedders))}
+	caches := make(map[string]*Cache, len(models.Embedders))
+	for id, emb := range models.Embedders {
+		c := NewCache(emb, id, size, ttl)
+		if store != nil {
+			c.Store = store
+		}
+		cached.Embedders[id] = c
+		caches[id] = c
+	}
+	return cached, caches
+}
@@ -0,0 +1,123 @@
+package embedder
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// countingEmbedder embeds every text into [calls] and counts its calls.
+type countingEmbedder struct{ calls int }
+
+func (e *countingEmbedder) Embed(context.Context, string) ([]float32, error) {
+	e.calls++
+	return []float32{float32(e.calls)}, nil
+}
+
+func (e *countingEmbedder) EmbedBatch(_ context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	return make([][]float32, len(texts)), nil
+}
+
+// memCacheStore is an in-memory CacheStore.
+type memCacheStore map[string]cacheEntry
+
+func (m memCacheStore) Get(_ context.Context, model, query string) ([]float32, time.Time, bool, error) {
+	e, ok := m[model+"|"+query]
+	return e.vector, e.expiresAt, ok, nil
+}
+
+func (m memCacheStore) Put(_ context.Context, model, query string, vector []float32, expiresAt time.Time) error {
+	m[model+"|"+query] = cacheEntry{vector: vector, expiresAt: expiresAt}
+	return nil
+}
+
+func (m memCacheStore) Prune(context.Context) error { return nil }
+
+func TestCache_HitsOnNormalizedQuery(t *testing.T) {
+	next := &countingEmbedder{}
+	c := NewCache(next, "m", 10, time.Hour)
+	ctx := context.Background()
+
+	_, _ = c.Embed(ctx, "Login crash")
+	vec, _ := c.Embed(ctx, "  login   CRASH ")
+
+	if next.calls != 1 || vec[0] != 1 {
+		t.Errorf("expected the second query to be served from the cache, got %d calls", next.calls)
+	}
+	if st := c.Stats(); st.Hits != 1 || st.Misses != 1 || st.Size != 1 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+}
+
+func TestCache_EvictsLeastRecentlyUsedAndExpired(t *testing.T) {
+	next := &countingEmbedder{}
+	c := NewCache(next, "m", 2, time.Hour)
+	ctx := context.Background()
+
+	_, _ = c.Embed(ctx, "a")
+	_, _ = c.Embed(ctx, "b")
+	_, _ = c.Embed(ctx, "a") // hit, b is now the oldest
+	_, _ = c.Embed(ctx, "c") // evicts b
+	_, _ = c.Embed(ctx, "b")
+	if next.calls != 4 {
+		t.Errorf("expected b to be evicted and embedded again, got %d calls", next.calls)
+	}
+
+	c = NewCache(next, "m", 2, -time.Second)
+	_, _ = c.Embed(ctx, "a")
+	_, _ = c.Embed(ctx, "a")
+	if st := c.Stats(); st.Hits != 0 {
+		t.Errorf("expected expired entries to miss, got %+v", st)
+	}
+}
+
+func TestCache_SharesEntriesThroughStorePerModel(t *testing.T) {
+	store := memCacheStore{}
+	ctx := context.Background()
+
+	first := NewCache(&countingEmbedder{}, "m1", 10, time.Hour)
+	first.Store = store
+	_, _ = first.Embed(ctx, "dark mode")
+
+	next := &countingEmbedder{}
+	replica := NewCache(next, "m1", 10, time.Hour)
+	replica.Store = store
+	_, _ = replica.Embed(ctx, "Dark Mode")
+	if next.calls != 0 {
+		t.Error("expected the replica to use the stored embedding")
+	}
+
+	other := NewCache(next, "m2", 10, time.Hour)
+	other.Store = store
+	_, _ = other.Embed(ctx, "dark mode")
+	if next.calls != 1 {
+		t.Error("expected another model not to share the entry")
+	}
+}
+
+func TestCache_KeepsExpiryOfStoredEntries(t *testing.T) {
+	expiresAt := time.Now().Add(time.Minute)
+	store := memCacheStore{"m|dark mode": {vector: []float32{1}, expiresAt: expiresAt}}
+	c := NewCache(&countingEmbedder{}, "m", 10, time.Hour)
+	c.Store = store
+
+	if _, err := c.Embed(context.Background(), "dark mode"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	entry := c.entries["dark mode"].Value.(*cacheEntry)
+	if !entry.expiresAt.Equal(expiresAt) {
+		t.Errorf("expected the entry to expire with the stored one at %v, got %v", expiresAt, entry.expiresAt)
+	}
+}
+
+func TestCache_DoesNotCacheBatches(t *testing.T) {
+	next := &countingEmbedder{}
+	c := NewCache(next, "m", 10, time.Hour)
+
+	_, _ = c.EmbedBatch(context.Background(), []string{"a"})
+	_, _ = c.EmbedBatch(context.Background(), []string{"a"})
+	if next.calls != 2 {
+		t.Errorf("expected batches to pass through, got %d calls", next.calls)
+	}
+}
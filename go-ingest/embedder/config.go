@@ -0,0 +1,118 @@
+package embedder
+
+import (
+	"fmt"
+
+	"github.com/zanmajeric/reporadar-go-ingest/config"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+const (
+	// KindReporadar is the bespoke /embed API of the Python service in py-worker.
+	KindReporadar = "reporadar"
+	KindOpenAI    = "openai"
+	KindOllama    = "ollama"
+	// KindHashing embeds offline, see HashingEmbedder.
+	KindHashing = "hashing"
+)
+
+// ModelID names the active model, e.g. to keep cached and stored vectors of different models apart. Unless set with
+// EmbeddingModelId it is derived from the embedder configuration.
+func ModelID(cfg *config.AppConfig) string {
+	if cfg.EmbeddingModelId != "" {
+		return cfg.EmbeddingModelId
+	}
+	switch cfg.EmbedderKind {
+	case "", KindReporadar:
+		return KindReporadar
+	case KindHashing:
+		return fmt.Sprintf("%s:%d", KindHashing, NewHashingEmbedder(cfg.EmbeddingDim).Dim)
+	}
+	return cfg.EmbedderKind + ":" + cfg.EmbedderModel
+}
+
+// ModelsFromConfig builds the embedders of the active model and of the further EmbeddingModels. Their vectors are
+// checked by the returned validators, which learn the dimensions that are not configured through Probe.
+func ModelsFromConfig(cfg *config.AppConfig) (search.Models, map[string]*Validator, error) {
+	active := activeModel(cfg)
+	models := search.Models{Active: active.Id, Embedders: map[string]search.Embedder{}}
+	validators := map[string]*Validator{}
+	for _, m := range append([]config.EmbeddingModelConfig{active}, cfg.EmbeddingModels...) {
+		if m.Id == "" {
+			return search.Models{}, nil, fmt.Errorf("EmbeddingModels: Id is required")
+		}
+		if _, ok := models.Embedders[m.Id]; ok {
+			return search.Models{}, nil, fmt.Errorf("EmbeddingModels: duplicate model %q", m.Id)
+		}
+		emb, err := newEmbedder(cfg, m)
+		if err != nil {
+			return search.Models{}, nil, fmt.Errorf("model %q: %w", m.Id, err)
+		}
+		validators[m.Id] = NewValidator(emb, m.Id, m.Dim)
+		models.Embedders[m.Id] = validators[m.Id]
+	}
+	return models, validators, nil
+}
+
+func activeModel(cfg *config.AppConfig) config.EmbeddingModelConfig {
+	return config.EmbeddingModelConfig{
+		Id:     ModelID(cfg),
+		Kind:   cfg.EmbedderKind,
+		Url:    cfg.EmbedderUrl,
+		Model:  cfg.EmbedderModel,
+		ApiKey: cfg.EmbedderApiKey,
+		Dim:    cfg.EmbeddingDim,
+	}
+}
+
+// Defaults of EmbedderRetries and EmbedderBreakerThreshold. The settings are pointers so that an explicit 0, which
+// turns retries or the breaker off, is told apart from a missing setting.
+const (
+	defaultRetries          = 2
+	defaultBreakerThreshold = 5
+)
+
+// valueOr returns the setting p, def when it is not set.
+func valueOr(p *int, def int) int {
+	if p == nil {
+		return def
+	}
+	return *p
+}
+
+// newEmbedder builds the embedder of m, every model gets its own circuit breaker.
+func newEmbedder(cfg *config.AppConfig, m config.EmbeddingModelConfig) (search.Embedder, error) {
+	policy := &Policy{
+		MaxAttempts: max(valueOr(cfg.EmbedderRetries, defaultRetries), 0) + 1,
+		BaseDelay:   cfg.EmbedderRetryDelay,
+		MaxDelay:    cfg.EmbedderMaxRetryDelay,
+		Breaker:     NewBreaker(valueOr(cfg.EmbedderBreakerThreshold, defaultBreakerThreshold), cfg.EmbedderBreakerCooldown),
+	}
+
+	switch m.Kind {
+	case "", KindReporadar:
+		c := NewClient(m.Url)
+		c.BatchSize = cfg.EmbedderMaxBatch
+		c.Policy = policy
+		return c, nil
+	case KindOpenAI:
+		if m.Model == "" {
+			return nil, fmt.Errorf("EmbedderModel is required for the %s embedder", KindOpenAI)
+		}
+		c := NewOpenAIClient(m.Url, m.Model, m.ApiKey)
+		c.BatchSize = cfg.EmbedderMaxBatch
+		c.Policy = policy
+		return c, nil
+	case KindOllama:
+		if m.Model == "" {
+			return nil, fmt.Errorf("EmbedderModel is required for the %s embedder", KindOllama)
+		}
+		c := NewOllamaClient(m.Url, m.Model)
+		c.Policy = policy
+		return c, nil
+	case KindHashing:
+		return NewHashingEmbedder(m.Dim), nil
+	}
+	return nil, fmt.Errorf("unknown EmbedderKind %q (%s, %s, %s or %s)", m.Kind,
+		KindReporadar, KindOpenAI, KindOllama, KindHashing)
+}
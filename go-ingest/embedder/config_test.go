@@ -0,0 +1,98 @@
+package embedder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zanmajeric/reporadar-go-ingest/config"
+)
+
+func TestNewEmbedder(t *testing.T) {
+	for _, tc := range []struct {
+		cfg     config.AppConfig
+		want    string
+		wantErr bool
+	}{
+		{cfg: config.AppConfig{}, want: "*embedder.Client"},
+		{cfg: config.AppConfig{EmbedderKind: KindOpenAI, EmbedderModel: "m"}, want: "*embedder.OpenAIClient"},
+		{cfg: config.AppConfig{EmbedderKind: KindOllama, EmbedderModel: "m"}, want: "*embedder.OllamaClient"},
+		{cfg: config.AppConfig{EmbedderKind: KindHashing}, want: "*embedder.HashingEmbedder"},
+		{cfg: config.AppConfig{EmbedderKind: KindOllama}, wantErr: true},
+		{cfg: config.AppConfig{EmbedderKind: "cohere"}, wantErr: true},
+	} {
+		emb, err := newEmbedder(&tc.cfg, activeModel(&tc.cfg))
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("kind %q: expected an error", tc.cfg.EmbedderKind)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("kind %q: unexpected error: %v", tc.cfg.EmbedderKind, err)
+			continue
+		}
+		if got := fmt.Sprintf("%T", emb); got != tc.want {
+			t.Errorf("kind %q: expected %s, got %s", tc.cfg.EmbedderKind, tc.want, got)
+		}
+	}
+}
+
+func TestNewEmbedder_RespectsExplicitZeroRetriesAndBreaker(t *testing.T) {
+	for _, tc := range []struct {
+		yaml                   string
+		wantAttempts, wantThrs int
+	}{
+		{yaml: "EmbedderUrl: localhost:8001\n", wantAttempts: 3, wantThrs: 5},
+		{yaml: "EmbedderRetries: 0\nEmbedderBreakerThreshold: 0\n", wantAttempts: 1, wantThrs: 0},
+		{yaml: "EmbedderRetries: 4\nEmbedderBreakerThreshold: 1\n", wantAttempts: 5, wantThrs: 1},
+	} {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(tc.yaml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		var cfg config.AppConfig
+		if err := config.LoadConfiguration([]string{path}, &cfg); err != nil {
+			t.Fatalf("load %q: %v", tc.yaml, err)
+		}
+		config.SetDefaultsConfiguration(&cfg)
+
+		emb, err := newEmbedder(&cfg, activeModel(&cfg))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		policy := emb.(*Client).Policy
+		if policy.MaxAttempts != tc.wantAttempts || policy.Breaker.Threshold != tc.wantThrs {
+			t.Errorf("%q: expected %d attempts and threshold %d, got %d and %d",
+				tc.yaml, tc.wantAttempts, tc.wantThrs, policy.MaxAttempts, policy.Breaker.Threshold)
+		}
+	}
+}
+
+func TestModelsFromConfig(t *testing.T) {
+	cfg := &config.AppConfig{
+		EmbedderKind:     KindHashing,
+		EmbeddingDim:     64,
+		EmbeddingModelId: "hash-64",
+		EmbeddingModels:  []config.EmbeddingModelConfig{{Id: "minilm", Kind: KindReporadar, Url: "localhost:8001"}},
+	}
+	models, validators, err := ModelsFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if models.Active != "hash-64" || len(models.Embedders) != 2 {
+		t.Errorf("unexpected models %+v", models)
+	}
+	if st := validators["hash-64"].Status(); st.Dim != 64 || st.DimSource != DimFromConfig {
+		t.Errorf("expected the configured dimension, got %+v", st)
+	}
+	if st := validators["minilm"].Status(); st.Dim != 0 {
+		t.Errorf("expected the dimension of minilm to be probed, got %+v", st)
+	}
+
+	cfg.EmbeddingModels = append(cfg.EmbeddingModels, config.EmbeddingModelConfig{Id: "hash-64", Kind: KindHashing})
+	if _, _, err := ModelsFromConfig(cfg); err == nil {
+		t.Error("expected an error for a duplicate model id")
+	}
+}
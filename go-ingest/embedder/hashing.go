@@ -0,0 +1,100 @@
+package embedder
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// DefaultDim matches the vector(384) column of all-MiniLM-L6-v2 embeddings.
+const DefaultDim = 384
+
+// HashingEmbedder embeds texts offline with signed feature hashing: words, word bigrams and character trigrams are
+// hashed into Dim buckets and the result is L2-normalized. The vectors only capture lexical overlap, but they are
+// deterministic and need neither a model server nor downloads, which makes them a fit for tests, CI and demos.
+type HashingEmbedder struct {
+	Dim int
+}
+
+func NewHashingEmbedder(dim int) *HashingEmbedder {
+	if dim <= 0 {
+		dim = DefaultDim
+	}
+	return &HashingEmbedder{Dim: dim}
+}
+
+// Feature weights: whole words carry most of the signal, trigrams make typos and inflections still overlap.
+const (
+	wordWeight    = 1.0
+	bigramWeight  = 0.5
+	trigramWeight = 0.25
+)
+
+var errEmptyText = errors.New("empty text")
+
+func (e *HashingEmbedder) Embed(_ context.Context, text string) ([]float32, error) {
+	words := tokenize(text)
+	if len(words) == 0 {
+		return nil, errEmptyText
+	}
+
+	vec := make([]float64, e.Dim)
+	for i, w := range words {
+		e.add(vec, "w:"+w, wordWeight)
+		if i > 0 {
+			e.add(vec, "b:"+words[i-1]+" "+w, bigramWeight)
+		}
+		padded := []rune("^" + w + "$")
+		for j := 0; j+3 <= len(padded); j++ {
+			e.add(vec, "c:"+string(padded[j:j+3]), trigramWeight)
+		}
+	}
+
+	var norm float64
+	for _, v := range vec {
+		norm += v * v
+	}
+	if norm == 0 {
+		return nil, errEmptyText
+	}
+	norm = math.Sqrt(norm)
+	out := make([]float32, e.Dim)
+	for i, v := range vec {
+		out[i] = float32(v / norm)
+	}
+	return out, nil
+}
+
+// EmbedBatch embeds every text on its own, empty texts fail.
+func (e *HashingEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	return embedInChunks(ctx, texts, len(texts), func(ctx context.Context, texts []string) ([][]float32, []error) {
+		vecs := make([][]float32, len(texts))
+		errs := make([]error, len(texts))
+		for i, text := range texts {
+			vecs[i], errs[i] = e.Embed(ctx, text)
+		}
+		return vecs, errs
+	})
+}
+
+// add hashes feature into a bucket, the sign comes from another bit of the hash so that collisions cancel out
+// instead of piling up.
+func (e *HashingEmbedder) add(vec []float64, feature string, weight float64) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(feature))
+	sum := h.Sum64()
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	vec[sum%uint64(e.Dim)] += weight
+}
+
+// tokenize lowercases text and splits it into runs of letters and digits.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
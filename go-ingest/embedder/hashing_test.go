@@ -0,0 +1,144 @@
+package embedder
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/zanmajeric/reporadar-go-ingest/config"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+func dot(a, b []float32) float64 {
+	var s float64
+	for i := range a {
+		s += float64(a[i]) * float64(b[i])
+	}
+	return s
+}
+
+func TestHashingEmbedder_DeterministicAndNormalized(t *testing.T) {
+	e := NewHashingEmbedder(64)
+	a, err := e.Embed(context.Background(), "App crashes on login")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := NewHashingEmbedder(64).Embed(context.Background(), "app CRASHES on login!")
+
+	if len(a) != 64 {
+		t.Errorf("expected 64 dimensions, got %d", len(a))
+	}
+	if n := dot(a, a); math.Abs(n-1) > 1e-5 {
+		t.Errorf("expected a unit vector, got squared norm %v", n)
+	}
+	if sim := dot(a, b); math.Abs(sim-1) > 1e-5 {
+		t.Errorf("expected case and punctuation to be ignored, got similarity %v", sim)
+	}
+}
+
+func TestHashingEmbedder_EmptyTextFails(t *testing.T) {
+	vecs, err := NewHashingEmbedder(0).EmbedBatch(context.Background(), []string{"dark mode", " -- "})
+
+	var batchErr *search.BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 1 || batchErr.Errors[1] == nil {
+		t.Fatalf("expected only item 1 to fail, got %v", err)
+	}
+	if len(vecs[0]) != DefaultDim {
+		t.Errorf("expected %d dimensions, got %d", DefaultDim, len(vecs[0]))
+	}
+}
+
+// memIssues is an in-memory search.IssueRepository ranking by inner product, like pgvector's <#>.
+type memIssues struct {
+	issues     []search.IssueRow
+	embeddings map[string][]float32
+}
+
+func (m *memIssues) SearchByVector(_ context.Context, repo string, emb search.Embedding, limit int, f search.Filter, _ search.Aggregation) ([]search.IssueRow, error) {
+	var out []search.IssueRow
+	for _, iss := range m.issues {
+		if iss.Repo != repo || iss.ID == f.ExcludeID {
+			continue
+		}
+		iss.Distance = -dot(emb.Vector, m.embeddings[iss.ID])
+		iss.HasDistance = true
+		out = append(out, iss)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Distance < out[j].Distance })
+	return out[:min(limit, len(out))], nil
+}
+
+func (m *memIssues) SearchByText(context.Context, string, string, *search.Embedding, int, search.Filter) ([]search.IssueRow, error) {
+	return nil, nil
+}
+
+func (m *memIssues) ListIssues(context.Context, string, search.Filter, search.Page) (search.IssuePage, error) {
+	return search.IssuePage{}, nil
+}
+
+func (m *memIssues) GetIssue(_ context.Context, id string) (search.IssueRow, error) {
+	for _, iss := range m.issues {
+		if iss.ID == id {
+			return iss, nil
+		}
+	}
+	return search.IssueRow{}, search.ErrIssueNotFound
+}
+
+func (m *memIssues) SearchByFingerprint(context.Context, string, string, int, search.Filter) ([]search.IssueRow, error) {
+	return nil, nil
+}
+
+func (m *memIssues) LinkedPullRequests(context.Context, []string) (map[string][]search.LinkedPR, error) {
+	return nil, nil
+}
+
+func (m *memIssues) GetEmbedding(_ context.Context, id string) (search.Embedding, error) {
+	if emb, ok := m.embeddings[id]; ok {
+		return search.Embedding{Model: "hashing", Vector: emb}, nil
+	}
+	return search.Embedding{}, search.ErrNoEmbedding
+}
+
+func TestHashingEmbedder_SearchAndDuplicatesEndToEnd(t *testing.T) {
+	ctx := context.Background()
+	e := NewHashingEmbedder(DefaultDim)
+	repo := &memIssues{
+		issues: []search.IssueRow{
+			{ID: "1", Repo: "demo", Title: "App crashes on login", Body: "NullPointerException after entering the password"},
+			{ID: "2", Repo: "demo", Title: "Crash when logging in", Body: "the app crashes with a NullPointerException on login"},
+			{ID: "3", Repo: "demo", Title: "Add dark mode", Body: "please support a dark theme in settings"},
+		},
+		embeddings: map[string][]float32{},
+	}
+	texts := make([]string, len(repo.issues))
+	for i, iss := range repo.issues {
+		texts[i] = iss.Title + "\n\n" + iss.Body
+	}
+	vecs, err := e.EmbedBatch(ctx, texts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, iss := range repo.issues {
+		repo.embeddings[iss.ID] = vecs[i]
+	}
+
+	srv := search.New(search.SingleModel("hashing", e), repo, config.AppConfig{StrongSimThr: 0.5, WeakSimThr: 0.2})
+	found, err := srv.Search(ctx, search.Query{Repo: "demo", Text: "app crashes on login", Limit: 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(found) == 0 || found[0].ID != "1" {
+		t.Fatalf("expected issue 1 first, got %+v", found)
+	}
+
+	dups, err := srv.Duplicates(ctx, search.IssueRow{ID: "1", Repo: "demo"}, search.Query{Repo: "demo", Limit: 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(dups) != 1 || dups[0].ID != "2" {
+		t.Errorf("expected only issue 2 as duplicate candidate, got %+v", dups)
+	}
+}
@@ -0,0 +1,59 @@
+package embedder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OllamaClient speaks the Ollama `POST /api/embeddings` protocol. It takes a single prompt per request, so batches
+// are embedded one text at a time.
+type OllamaClient struct {
+	BaseURL    string
+	Model      string
+	HTTPClient *http.Client
+	Policy     *Policy
+}
+
+func NewOllamaClient(baseURL, model string) *OllamaClient {
+	return &OllamaClient{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Model:   model,
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+type ollamaRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+type ollamaResponse struct {
+	Embedding []float32 `json:"embedding"`
+}
+
+func (c *OllamaClient) Embed(ctx context.Context, text string) ([]float32, error) {
+	var resp ollamaResponse
+	err := c.Policy.Do(ctx, func(ctx context.Context) error {
+		return postJSON(ctx, c.HTTPClient, c.BaseURL+"/api/embeddings", nil, ollamaRequest{Model: c.Model, Prompt: text}, &resp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Embedding) == 0 {
+		return nil, fmt.Errorf("empty embedding")
+	}
+	return resp.Embedding, nil
+}
+
+// EmbedBatch embeds every text with its own request, failed items do not stop the others.
+func (c *OllamaClient) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	return embedInChunks(ctx, texts, 1, func(ctx context.Context, texts []string) ([][]float32, []error) {
+		vec, err := c.Embed(ctx, texts[0])
+		return [][]float32{vec}, []error{err}
+	})
+}
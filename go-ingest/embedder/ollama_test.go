@@ -0,0 +1,41 @@
+package embedder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+func TestOllamaClient_EmbedBatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/embeddings" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var req ollamaRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "all-minilm" {
+			t.Errorf("unexpected model %q", req.Model)
+		}
+		if req.Prompt == "boom" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(ollamaResponse{Embedding: []float32{float32(len(req.Prompt))}})
+	}))
+	defer srv.Close()
+
+	vecs, err := NewOllamaClient(srv.URL+"/", "all-minilm").EmbedBatch(context.Background(), []string{"ab", "boom", "abcd"})
+
+	var batchErr *search.BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 1 || batchErr.Errors[1] == nil {
+		t.Fatalf("expected only item 1 to fail, got %v", err)
+	}
+	if vecs[0][0] != 2 || vecs[2][0] != 4 {
+		t.Errorf("unexpected vectors %v", vecs)
+	}
+}
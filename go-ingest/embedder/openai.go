@@ -0,0 +1,89 @@
+package embedder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAIClient speaks the OpenAI-compatible `POST /v1/embeddings` protocol, which is also served by vLLM, LocalAI,
+// llama.cpp and text-embeddings-inference among others.
+type OpenAIClient struct {
+	// BaseURL is the server root without the /v1 suffix, e.g. https://api.openai.com.
+	BaseURL    string
+	Model      string
+	APIKey     string
+	HTTPClient *http.Client
+	// BatchSize is the maximum number of inputs per request, larger batches are split.
+	BatchSize int
+	Policy    *Policy
+}
+
+func NewOpenAIClient(baseURL, model, apiKey string) *OpenAIClient {
+	return &OpenAIClient{
+		BaseURL: strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1"),
+		Model:   model,
+		APIKey:  apiKey,
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		BatchSize: DefaultBatchSize,
+	}
+}
+
+type openAIRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type openAIResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (c *OpenAIClient) Embed(ctx context.Context, text string) ([]float32, error) {
+	vecs, errs := c.embedChunk(ctx, []string{text})
+	if errs[0] != nil {
+		return nil, errs[0]
+	}
+	return vecs[0], nil
+}
+
+// EmbedBatch embeds texts in requests of at most BatchSize inputs. A failed request fails all of its items.
+func (c *OpenAIClient) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	return embedInChunks(ctx, texts, c.BatchSize, c.embedChunk)
+}
+
+func (c *OpenAIClient) embedChunk(ctx context.Context, texts []string) ([][]float32, []error) {
+	header := http.Header{}
+	if c.APIKey != "" {
+		header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	var resp openAIResponse
+	err := c.Policy.Do(ctx, func(ctx context.Context) error {
+		return postJSON(ctx, c.HTTPClient, c.BaseURL+"/v1/embeddings", header, openAIRequest{Model: c.Model, Input: texts}, &resp)
+	})
+	if err != nil {
+		return failAll(len(texts), err)
+	}
+
+	// The data items carry their input index, servers are not required to keep the order.
+	vecs := make([][]float32, len(texts))
+	errs := make([]error, len(texts))
+	for _, d := range resp.Data {
+		if d.Index >= 0 && d.Index < len(texts) {
+			vecs[d.Index] = d.Embedding
+		}
+	}
+	for i, v := range vecs {
+		if len(v) == 0 {
+			errs[i] = fmt.Errorf("empty embedding")
+		}
+	}
+	return vecs, errs
+}
@@ -0,0 +1,69 @@
+package embedder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+func TestOpenAIClient_EmbedBatch(t *testing.T) {
+	var batches [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("unexpected authorization header %q", got)
+		}
+		var req openAIRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "nomic-embed-text" {
+			t.Errorf("unexpected model %q", req.Model)
+		}
+		batches = append(batches, req.Input)
+
+		// answer in reverse order to check the index is honoured
+		var resp openAIResponse
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			resp.Data = append(resp.Data, struct {
+				Index     int       `json:"index"`
+				Embedding []float32 `json:"embedding"`
+			}{i, []float32{float32(len(req.Input[i]))}})
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	c := NewOpenAIClient(srv.URL+"/v1", "nomic-embed-text", "sk-test")
+	c.BatchSize = 2
+	vecs, err := c.EmbedBatch(context.Background(), []string{"a", "bb", "ccc"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(batches) != 2 {
+		t.Errorf("expected 2 requests, got %d", len(batches))
+	}
+	for i, want := range []float32{1, 2, 3} {
+		if len(vecs[i]) != 1 || vecs[i][0] != want {
+			t.Errorf("item %d: expected [%v], got %v", i, want, vecs[i])
+		}
+	}
+}
+
+func TestOpenAIClient_EmbedBatchFailedRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	_, err := NewOpenAIClient(srv.URL, "m", "").EmbedBatch(context.Background(), []string{"a", "b"})
+	var batchErr *search.BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 2 {
+		t.Errorf("expected both items to fail, got %v", err)
+	}
+}
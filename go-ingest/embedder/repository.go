@@ -0,0 +1,63 @@
+package embedder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zanmajeric/reporadar-go-ingest/utils"
+)
+
+// PgCacheStore keeps cached query embeddings in the query_embedding_cache table.
+type PgCacheStore struct {
+	db *pgxpool.Pool
+}
+
+func NewPgCacheStore(db *pgxpool.Pool) *PgCacheStore {
+	return &PgCacheStore{db: db}
+}
+
+func (pgr *PgCacheStore) Get(ctx context.Context, model, query string) ([]float32, time.Time, bool, error) {
+	const qSQL = `
+		SELECT embedding::text, expires_at FROM query_embedding_cache
+		WHERE model = $1 AND query = $2 AND expires_at > now()
+	`
+	var (
+		literal   string
+		expiresAt time.Time
+	)
+	err := pgr.db.QueryRow(ctx, qSQL, model, query).Scan(&literal, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, time.Time{}, false, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("db error: %w", err)
+	}
+	vec, err := utils.VectorLiteralToEmbedding(literal)
+	if err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("invalid cached embedding: %w", err)
+	}
+	return vec, expiresAt, true, nil
+}
+
+func (pgr *PgCacheStore) Put(ctx context.Context, model, query string, vector []float32, expiresAt time.Time) error {
+	const qSQL = `
+		INSERT INTO query_embedding_cache (model, query, embedding, expires_at)
+		VALUES ($1, $2, $3::vector, $4)
+		ON CONFLICT (model, query) DO UPDATE SET embedding = EXCLUDED.embedding, expires_at = EXCLUDED.expires_at
+	`
+	if _, err := pgr.db.Exec(ctx, qSQL, model, query, utils.EmbeddingToVectorLiteral(vector), expiresAt); err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+	return nil
+}
+
+func (pgr *PgCacheStore) Prune(ctx context.Context) error {
+	if _, err := pgr.db.Exec(ctx, `DELETE FROM query_embedding_cache WHERE expires_at <= now()`); err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+	return nil
+}
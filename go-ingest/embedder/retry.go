@@ -0,0 +1,174 @@
+package embedder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+// StatusError is a non-200 response of the embedder.
+type StatusError struct {
+	Code int
+	// RetryAfter is the delay asked for by a 429 or 503 response, zero when there was none.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.Code)
+}
+
+func newStatusError(resp *http.Response) *StatusError {
+	err := &StatusError{Code: resp.StatusCode}
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if secs, convErr := strconv.Atoi(v); convErr == nil && secs >= 0 {
+			err.RetryAfter = time.Duration(secs) * time.Second
+		} else if at, parseErr := http.ParseTime(v); parseErr == nil {
+			err.RetryAfter = max(time.Until(at), 0)
+		}
+	}
+	return err
+}
+
+// Policy retries transient embedder failures with jittered exponential backoff and stops calling an embedder that
+// keeps failing through its Breaker. A nil Policy makes a single attempt.
+type Policy struct {
+	// MaxAttempts includes the first call.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Breaker     *Breaker
+}
+
+// Do runs call until it succeeds, fails with a permanent error, runs out of attempts or ctx is done. Transient
+// failures that remain, as well as calls rejected by the open breaker, wrap search.ErrEmbedderUnavailable.
+func (p *Policy) Do(ctx context.Context, call func(ctx context.Context) error) error {
+	if p == nil {
+		return call(ctx)
+	}
+	if wait, ok := p.Breaker.Allow(); !ok {
+		return fmt.Errorf("%w: circuit open after repeated failures, retry in %v", search.ErrEmbedderUnavailable, wait.Round(time.Second))
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := call(ctx)
+		if ctx.Err() != nil {
+			return err
+		}
+		if err == nil || !transient(err) {
+			// Anything but a transient failure means the embedder is reachable.
+			p.Breaker.Success()
+			return err
+		}
+
+		delay := p.backoff(attempt)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			delay = statusErr.RetryAfter
+		}
+		deadline, hasDeadline := ctx.Deadline()
+		if attempt >= p.MaxAttempts || (hasDeadline && time.Until(deadline) < delay) {
+			p.Breaker.Failure()
+			return fmt.Errorf("%w: %v (after %d attempts)", search.ErrEmbedderUnavailable, err, attempt)
+		}
+		log.Printf("[embedder] attempt=%d failed: %v, retrying in %v", attempt, err, delay)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff is the jittered delay after the given failed attempt.
+func (p *Policy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << min(attempt-1, 16)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// transient reports whether err is worth retrying: the embedder could not be reached, dropped the connection,
+// timed out, is rate limiting or failed with a 5xx.
+func transient(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code == http.StatusTooManyRequests || statusErr.Code >= 500
+	}
+	var netErr net.Error
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// Breaker opens after Threshold consecutive failed calls and rejects calls for Cooldown. After that a single probe
+// call is let through per Cooldown, which closes the breaker again when it succeeds. A nil Breaker never opens.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Threshold: threshold, Cooldown: cooldown}
+}
+
+// Allow reports whether a call may go ahead, otherwise how long the breaker stays open.
+func (b *Breaker) Allow() (time.Duration, bool) {
+	if b == nil || b.Threshold <= 0 {
+		return 0, true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.Threshold {
+		return 0, true
+	}
+	if wait := time.Until(b.openUntil); wait > 0 {
+		return wait, false
+	}
+	// Half open: this call is the probe, the others wait for its outcome or for another cooldown.
+	b.openUntil = time.Now().Add(b.Cooldown)
+	return 0, true
+}
+
+func (b *Breaker) Success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures >= b.Threshold && b.Threshold > 0 {
+		log.Printf("[embedder] circuit closed")
+	}
+	b.failures = 0
+}
+
+func (b *Breaker) Failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.Threshold > 0 && b.failures >= b.Threshold {
+		b.openUntil = time.Now().Add(b.Cooldown)
+		log.Printf("[embedder] circuit open for %v after %d failed calls", b.Cooldown, b.failures)
+	}
+}
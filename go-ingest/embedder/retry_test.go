@@ -0,0 +1,112 @@
+package embedder
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+func testPolicy(threshold int) *Policy {
+	return &Policy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    5 * time.Millisecond,
+		Breaker:     NewBreaker(threshold, time.Hour),
+	}
+}
+
+func TestPolicy_RetriesTransientFailures(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"embedding": [0.5]}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	c.Policy = testPolicy(5)
+	vec, err := c.Embed(context.Background(), "text")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(vec) != 1 || calls.Load() != 3 {
+		t.Errorf("expected success on the third attempt, got %v after %d calls", vec, calls.Load())
+	}
+}
+
+func TestPolicy_DoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	c.Policy = testPolicy(5)
+	_, err := c.Embed(context.Background(), "text")
+	if err == nil || errors.Is(err, search.ErrEmbedderUnavailable) {
+		t.Errorf("expected a permanent error, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected a single call, got %d", calls.Load())
+	}
+}
+
+func TestPolicy_BreakerFastFailsWhenEmbedderIsDown(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close() // connection refused from now on
+
+	c := NewClient(url)
+	c.Policy = testPolicy(2)
+	for i := 0; i < 2; i++ {
+		if _, err := c.Embed(context.Background(), "text"); !errors.Is(err, search.ErrEmbedderUnavailable) {
+			t.Fatalf("call %d: expected ErrEmbedderUnavailable, got %v", i, err)
+		}
+	}
+
+	start := time.Now()
+	_, err := c.Embed(context.Background(), "text")
+	if !errors.Is(err, search.ErrEmbedderUnavailable) {
+		t.Fatalf("expected ErrEmbedderUnavailable from the open breaker, got %v", err)
+	}
+	if time.Since(start) > 50*time.Millisecond {
+		t.Errorf("expected the open breaker to fail fast, took %v", time.Since(start))
+	}
+}
+
+func TestBreaker_ProbeClosesAfterCooldown(t *testing.T) {
+	b := NewBreaker(1, time.Millisecond)
+	b.Failure()
+	if _, ok := b.Allow(); ok {
+		t.Fatal("expected the breaker to be open")
+	}
+	time.Sleep(2 * time.Millisecond)
+	if _, ok := b.Allow(); !ok {
+		t.Fatal("expected a probe after the cooldown")
+	}
+	if _, ok := b.Allow(); ok {
+		t.Error("expected a single probe at a time")
+	}
+	b.Success()
+	if _, ok := b.Allow(); !ok {
+		t.Error("expected the breaker to close after a successful probe")
+	}
+}
+
+func TestNewStatusError_RetryAfter(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"7"}}}
+	if err := newStatusError(resp); err.RetryAfter != 7*time.Second || !transient(err) {
+		t.Errorf("expected a transient error retrying after 7s, got %+v", err)
+	}
+}
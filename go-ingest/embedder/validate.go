@@ -0,0 +1,186 @@
+package embedder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+// ErrInvalidVector is wrapped by the errors of vectors rejected by a Validator.
+var ErrInvalidVector = errors.New("invalid embedding")
+
+// normTolerance is how far the L2 norm of a vector may be off 1 before it is normalized again.
+const normTolerance = 1e-3
+
+// probeText is embedded at startup to learn the dimension of a model.
+const probeText = "reporadar dimension probe"
+
+// Dimension sources reported by ValidatorStatus.
+const (
+	DimFromConfig      = "config"
+	DimFromProbe       = "probe"
+	DimFromFirstVector = "first_vector"
+)
+
+// ValidatorStatus is what /health reports about an embedding model.
+type ValidatorStatus struct {
+	Dim       int    `json:"dim"`
+	DimSource string `json:"dim_source,omitempty"`
+	// ProbeError is the error of the startup probe, the dimension is then learnt from the first vector.
+	ProbeError   string `json:"probe_error,omitempty"`
+	Rejected     int64  `json:"rejected"`
+	Renormalized int64  `json:"renormalized"`
+	LastError    string `json:"last_error,omitempty"`
+}
+
+// Validator checks every vector of the wrapped embedder before it reaches Postgres: it must have the expected
+// dimension and finite values. Vectors that are not L2-normalized are normalized, since similarity is the inner
+// product, and all-zero vectors are rejected. The dimension comes from the configuration or, when not configured,
+// from Probe.
+type Validator struct {
+	next  search.Embedder
+	model string
+
+	mu         sync.Mutex
+	dim        int
+	dimSource  string
+	probeError string
+	lastError  string
+
+	rejected     atomic.Int64
+	renormalized atomic.Int64
+}
+
+// NewValidator validates the vectors of the model against dim, or the dimension learnt by Probe when dim is 0.
+func NewValidator(next search.Embedder, model string, dim int) *Validator {
+	v := &Validator{next: next, model: model, dim: dim}
+	if dim > 0 {
+		v.dimSource = DimFromConfig
+	}
+	return v
+}
+
+// Probe learns the dimension of the model with a single embedding when it is not configured. When the embedder
+// cannot be reached the dimension is learnt from the first vector later on.
+func (v *Validator) Probe(ctx context.Context) error {
+	v.mu.Lock()
+	known := v.dim > 0
+	v.mu.Unlock()
+	if known {
+		return nil
+	}
+
+	vec, err := v.next.Embed(ctx, probeText)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err != nil {
+		v.probeError = err.Error()
+		return fmt.Errorf("probe of model %s failed: %w", v.model, err)
+	}
+	if v.dim == 0 {
+		v.dim, v.dimSource, v.probeError = len(vec), DimFromProbe, ""
+	}
+	log.Printf("[embedder] model=%s dim=%d source=%s", v.model, v.dim, v.dimSource)
+	return nil
+}
+
+func (v *Validator) Embed(ctx context.Context, text string) ([]float32, error) {
+	vec, err := v.next.Embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	return v.check(vec)
+}
+
+func (v *Validator) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	vecs, err := v.next.EmbedBatch(ctx, texts)
+	var batchErr *search.BatchError
+	if err != nil && !errors.As(err, &batchErr) {
+		return nil, err
+	}
+	if batchErr == nil {
+		batchErr = &search.BatchError{Errors: map[int]error{}}
+	}
+	for i, vec := range vecs {
+		if batchErr.Errors[i] != nil {
+			continue
+		}
+		if vecs[i], err = v.check(vec); err != nil {
+			batchErr.Errors[i] = err
+		}
+	}
+	if len(batchErr.Errors) > 0 {
+		return vecs, batchErr
+	}
+	return vecs, nil
+}
+
+func (v *Validator) Status() ValidatorStatus {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return ValidatorStatus{
+		Dim:          v.dim,
+		DimSource:    v.dimSource,
+		ProbeError:   v.probeError,
+		Rejected:     v.rejected.Load(),
+		Renormalized: v.renormalized.Load(),
+		LastError:    v.lastError,
+	}
+}
+
+// check validates vec, returning it normalized.
+func (v *Validator) check(vec []float32) ([]float32, error) {
+	out, err := v.validate(vec)
+	if err != nil {
+		v.rejected.Add(1)
+		v.mu.Lock()
+		v.lastError = fmt.Sprintf("%s: %v", time.Now().UTC().Format(time.RFC3339), err)
+		v.mu.Unlock()
+		log.Printf("[embedder] model=%s rejected vector: %v", v.model, err)
+		return nil, err
+	}
+	return out, nil
+}
+
+func (v *Validator) validate(vec []float32) ([]float32, error) {
+	v.mu.Lock()
+	if v.dim == 0 && len(vec) > 0 {
+		v.dim, v.dimSource = len(vec), DimFromFirstVector
+		log.Printf("[embedder] model=%s dim=%d source=%s", v.model, v.dim, v.dimSource)
+	}
+	dim := v.dim
+	v.mu.Unlock()
+
+	if len(vec) != dim {
+		return nil, fmt.Errorf("%w: model %s: expected %d dimensions, got %d", ErrInvalidVector, v.model, dim, len(vec))
+	}
+	var sum float64
+	for i, x := range vec {
+		f := float64(x)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("%w: model %s: value %d is %v", ErrInvalidVector, v.model, i, x)
+		}
+		sum += f * f
+	}
+	if sum == 0 {
+		return nil, fmt.Errorf("%w: model %s: zero vector", ErrInvalidVector, v.model)
+	}
+	norm := math.Sqrt(sum)
+	if math.Abs(norm-1) <= normTolerance {
+		return vec, nil
+	}
+
+	v.renormalized.Add(1)
+	out := make([]float32, len(vec))
+	for i, x := range vec {
+		out[i] = float32(float64(x) / norm)
+	}
+	return out, nil
+}
@@ -0,0 +1,80 @@
+package embedder
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+// fixedEmbedder returns the vector of every text from a map.
+type fixedEmbedder map[string][]float32
+
+func (e fixedEmbedder) Embed(_ context.Context, text string) ([]float32, error) {
+	return e[text], nil
+}
+
+func (e fixedEmbedder) EmbedBatch(_ context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		out[i] = e[text]
+	}
+	return out, nil
+}
+
+func TestValidator_RejectsWrongDimensionAndNonFinite(t *testing.T) {
+	v := NewValidator(fixedEmbedder{
+		"ok":   {0.6, 0.8},
+		"long": {0.6, 0.8, 0},
+		"nan":  {float32(math.NaN()), 1},
+		"zero": {0, 0},
+	}, "m", 2)
+
+	if _, err := v.Embed(context.Background(), "ok"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, text := range []string{"long", "nan", "zero"} {
+		if _, err := v.Embed(context.Background(), text); !errors.Is(err, ErrInvalidVector) {
+			t.Errorf("%s: expected ErrInvalidVector, got %v", text, err)
+		}
+	}
+	if st := v.Status(); st.Rejected != 3 || st.LastError == "" {
+		t.Errorf("unexpected status %+v", st)
+	}
+}
+
+func TestValidator_NormalizesVectors(t *testing.T) {
+	v := NewValidator(fixedEmbedder{"a": {3, 4}}, "m", 2)
+
+	vec, err := v.Embed(context.Background(), "a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if math.Abs(float64(vec[0])-0.6) > 1e-6 || math.Abs(float64(vec[1])-0.8) > 1e-6 {
+		t.Errorf("expected [0.6 0.8], got %v", vec)
+	}
+	if st := v.Status(); st.Renormalized != 1 {
+		t.Errorf("expected one normalized vector, got %+v", st)
+	}
+}
+
+func TestValidator_ProbeLearnsDimension(t *testing.T) {
+	v := NewValidator(fixedEmbedder{probeText: {1, 0, 0}, "short": {1, 0}}, "m", 0)
+	if err := v.Probe(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st := v.Status(); st.Dim != 3 || st.DimSource != DimFromProbe {
+		t.Errorf("expected dimension 3 from the probe, got %+v", st)
+	}
+
+	vecs, err := v.EmbedBatch(context.Background(), []string{probeText, "short"})
+	var batchErr *search.BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 1 || batchErr.Errors[1] == nil {
+		t.Fatalf("expected only item 1 to be rejected, got %v", err)
+	}
+	if len(vecs[0]) != 3 {
+		t.Errorf("expected item 0 to pass, got %v", vecs[0])
+	}
+}
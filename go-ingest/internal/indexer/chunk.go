@@ -0,0 +1,135 @@
+package indexer
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/textnorm"
+)
+
+const (
+	ChunkText = "text"
+	ChunkCode = "code"
+	// ChunkComment is a part of a comment, embedded on its own with CommentsSeparate.
+	ChunkComment = "comment"
+)
+
+// DefaultChunkChars keeps chunks within the 256 token window of small sentence transformers like all-MiniLM-L6-v2.
+const DefaultChunkChars = 1000
+
+// Chunk is a part of an issue that is embedded on its own, so text past the model's token limit is not lost.
+type Chunk struct {
+	Index int
+	// Kind is ChunkText, ChunkCode or ChunkComment.
+	Kind   string
+	Text   string
+	Vector []float32
+	// CommentID is the comment a ChunkComment chunk is part of.
+	CommentID string
+}
+
+// SplitIssue splits an issue into chunks of at most maxChars characters. Issues that fit are a single chunk of their
+// whole text. Longer ones get the title and the body's paragraphs packed into text chunks, while fenced code blocks
+// (logs, stack traces) become chunks of their own; anything still too long is split at line breaks.
+func SplitIssue(title, body string, maxChars int) []Chunk {
+	if maxChars <= 0 {
+		maxChars = DefaultChunkChars
+	}
+	if text := title + "\n\n" + body; utf8.RuneCountInString(text) <= maxChars {
+		return []Chunk{{Kind: ChunkText, Text: text}}
+	}
+
+	var chunks []Chunk
+	add := func(kind, text string) {
+		for _, part := range splitLong(text, maxChars) {
+			chunks = append(chunks, Chunk{Index: len(chunks), Kind: kind, Text: part})
+		}
+	}
+	// Paragraphs are packed into the current text chunk until it is full, the title opens the first one.
+	current := strings.TrimSpace(title)
+	flush := func() {
+		if current != "" {
+			add(ChunkText, current)
+		}
+		current = ""
+	}
+	for _, b := range textnorm.SplitBlocks(body) {
+		text := strings.TrimSpace(b.Text())
+		if text == "" {
+			continue
+		}
+		if b.Code {
+			flush()
+			add(ChunkCode, text)
+			continue
+		}
+		for _, para := range strings.Split(text, "\n\n") {
+			if para = strings.TrimSpace(para); para == "" {
+				continue
+			}
+			if current != "" && utf8.RuneCountInString(current)+2+utf8.RuneCountInString(para) > maxChars {
+				flush()
+			}
+			if current != "" {
+				current += "\n\n"
+			}
+			current += para
+		}
+	}
+	flush()
+	return chunks
+}
+
+// SplitComment splits a comment into ChunkComment chunks of at most maxChars characters, numbered from first on.
+func SplitComment(commentID, body string, first, maxChars int) []Chunk {
+	if maxChars <= 0 {
+		maxChars = DefaultChunkChars
+	}
+	var chunks []Chunk
+	for _, part := range splitLong(strings.TrimSpace(body), maxChars) {
+		chunks = append(chunks, Chunk{Index: first + len(chunks), Kind: ChunkComment, Text: part, CommentID: commentID})
+	}
+	return chunks
+}
+
+// splitLong cuts text into pieces of at most maxChars characters, at line breaks where possible.
+func splitLong(text string, maxChars int) []string {
+	var (
+		out     []string
+		current string
+	)
+	for _, line := range strings.Split(text, "\n") {
+		for utf8.RuneCountInString(line) > maxChars {
+			if current != "" {
+				out = append(out, current)
+				current = ""
+			}
+			cut := runeOffset(line, maxChars)
+			out = append(out, line[:cut])
+			line = line[cut:]
+		}
+		if current != "" && utf8.RuneCountInString(current)+1+utf8.RuneCountInString(line) > maxChars {
+			out = append(out, current)
+			current = ""
+		}
+		if current != "" {
+			current += "\n"
+		}
+		current += line
+	}
+	if strings.TrimSpace(current) != "" {
+		out = append(out, current)
+	}
+	return out
+}
+
+// runeOffset is the byte offset of the n-th rune of s.
+func runeOffset(s string, n int) int {
+	for i := range s {
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return len(s)
+}
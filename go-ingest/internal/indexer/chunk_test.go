@@ -0,0 +1,64 @@
+package indexer
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitIssue_ShortIssueIsOneChunk(t *testing.T) {
+	chunks := SplitIssue("Crash on login", "Steps:\n\n```\npanic: nil map\n```", 100)
+
+	if len(chunks) != 1 || chunks[0].Text != "Crash on login\n\nSteps:\n\n```\npanic: nil map\n```" {
+		t.Errorf("expected the whole issue as one chunk, got %+v", chunks)
+	}
+}
+
+func TestSplitIssue_SeparatesCodeBlocksAndPacksParagraphs(t *testing.T) {
+	body := "First paragraph.\n\nSecond paragraph.\n\n```go\n" + strings.Repeat("log line\n", 20) + "```\n\n" +
+		"Third paragraph at the bottom."
+	chunks := SplitIssue("Title", body, 60)
+
+	var kinds []string
+	for i, c := range chunks {
+		if c.Index != i {
+			t.Errorf("chunk %d has index %d", i, c.Index)
+		}
+		if n := utf8.RuneCountInString(c.Text); n > 60 {
+			t.Errorf("chunk %d has %d characters", i, n)
+		}
+		if strings.Contains(c.Text, "```") {
+			t.Errorf("chunk %d contains a fence: %q", i, c.Text)
+		}
+		kinds = append(kinds, c.Kind)
+	}
+	if chunks[0].Text != "Title\n\nFirst paragraph.\n\nSecond paragraph." {
+		t.Errorf("expected the title and the first paragraphs in chunk 0, got %q", chunks[0].Text)
+	}
+	if last := chunks[len(chunks)-1]; last.Kind != ChunkText || last.Text != "Third paragraph at the bottom." {
+		t.Errorf("expected the last paragraph as a text chunk, got %+v", last)
+	}
+	// 20 lines of 8 characters are split into chunks of 6 lines at most.
+	want := "text code code code code text"
+	if got := strings.Join(kinds, " "); got != want {
+		t.Errorf("expected kinds %q, got %q", want, got)
+	}
+}
+
+func TestSplitIssue_CutsLongLines(t *testing.T) {
+	chunks := SplitIssue("T", strings.Repeat("é", 250), 100)
+
+	var total int
+	for _, c := range chunks {
+		if n := utf8.RuneCountInString(c.Text); n > 100 {
+			t.Errorf("chunk %d has %d characters", c.Index, n)
+		}
+		if !utf8.ValidString(c.Text) {
+			t.Errorf("chunk %d was cut inside a rune", c.Index)
+		}
+		total += strings.Count(c.Text, "é")
+	}
+	if total != 250 {
+		t.Errorf("expected all 250 characters to be kept, got %d", total)
+	}
+}
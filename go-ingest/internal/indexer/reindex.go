@@ -0,0 +1,112 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/jobs"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+const ReindexJobKind = "reindex"
+
+type ReindexParams struct {
+	Model string `json:"model"`
+}
+
+type ReindexStats struct {
+	Model    string `json:"model"`
+	Embedded int    `json:"embedded"`
+	// Switched is set once the repo is searched with the new model.
+	Switched bool `json:"switched"`
+}
+
+type ReindexStore interface {
+	// PendingReindex returns up to n issues of repo without an up-to-date staged vector of model.
+	PendingReindex(ctx context.Context, repo, model string, n int) ([]Pending, error)
+	// SaveReindexed stages the issue vector and replaces the issue's chunks of model, which are not searched before
+	// the switch. The normalized body is stored right away.
+	SaveReindexed(ctx context.Context, p Pending, model string, e Embedded) error
+	// SwitchModel atomically moves the staged vectors of model into the repo's issues and makes model the repo's
+	// model. It returns false without changes when an issue has no up-to-date staged vector yet.
+	SwitchModel(ctx context.Context, repo, model string) (bool, error)
+}
+
+// Reindexer re-embeds all issues of a repo with another model. The new vectors are staged next to the current ones,
+// so search keeps using the old model until every issue is embedded and the repo is switched over in one
+// transaction. An interrupted or failed re-index resumes from the staged vectors when run again.
+type Reindexer struct {
+	store  ReindexStore
+	models search.Models
+	// opts of the worker, only BatchSize, ChunkChars and Normalizer apply.
+	opts Options
+}
+
+func NewReindexer(store ReindexStore, models search.Models, opts Options) *Reindexer {
+	return &Reindexer{
+		store:  store,
+		models: models,
+		opts:   opts,
+	}
+}
+
+// RunJob runs a re-index job, see jobs.Handler.
+func (r *Reindexer) RunJob(ctx context.Context, job jobs.Job, report jobs.ReportFunc) (any, error) {
+	var params ReindexParams
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		return nil, fmt.Errorf("invalid job params: %w", err)
+	}
+	stats, err := r.Reindex(ctx, job.Repo, params.Model, func(st ReindexStats) { report(st) })
+	return stats, err
+}
+
+// Reindex embeds the issues of repo with model and switches the repo over once all of them are done. Issues that
+// change while the job runs are embedded again before the switch. Any issue that cannot be embedded fails the job,
+// the repo then stays on its current model.
+func (r *Reindexer) Reindex(ctx context.Context, repo, model string, progress func(ReindexStats)) (ReindexStats, error) {
+	model, embedder, err := r.models.Embedder(model)
+	if err != nil {
+		return ReindexStats{}, err
+	}
+	stats := ReindexStats{Model: model}
+	start := time.Now()
+	log.Printf("[reindex] repo=%s model=%s started", repo, model)
+
+	for {
+		batch, err := r.store.PendingReindex(ctx, repo, model, r.opts.BatchSize)
+		if err != nil {
+			return stats, fmt.Errorf("db error: %w", err)
+		}
+		if len(batch) == 0 {
+			switched, err := r.store.SwitchModel(ctx, repo, model)
+			if err != nil {
+				return stats, fmt.Errorf("db error: %w", err)
+			}
+			if switched {
+				stats.Switched = true
+				log.Printf("[reindex] repo=%s model=%s embedded=%d switched time=%v", repo, model, stats.Embedded, time.Since(start))
+				return stats, nil
+			}
+			// Issues changed after they were embedded, pick them up again.
+			continue
+		}
+
+		embedded, itemErrs, err := embedAll(ctx, embedder, batch, r.opts)
+		if err != nil {
+			return stats, err
+		}
+		for i, p := range batch {
+			if err := itemErrs[i]; err != nil {
+				return stats, fmt.Errorf("issue %s: %w", p.ID, err)
+			}
+			if err := r.store.SaveReindexed(ctx, p, model, embedded[i]); err != nil {
+				return stats, fmt.Errorf("db error: %w", err)
+			}
+			stats.Embedded++
+		}
+		progress(stats)
+	}
+}
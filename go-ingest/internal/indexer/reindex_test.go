@@ -0,0 +1,87 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+// memReindexStore stages vectors in memory. The first switch finds issue "late" changed, which has to be embedded
+// again before the switch succeeds.
+type memReindexStore struct {
+	issues   []Pending
+	staged   map[string][]float32
+	switches int
+	model    string
+}
+
+func (m *memReindexStore) PendingReindex(_ context.Context, _, _ string, n int) ([]Pending, error) {
+	var out []Pending
+	for _, p := range m.issues {
+		if _, ok := m.staged[p.ID]; !ok && len(out) < n {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (m *memReindexStore) SaveReindexed(_ context.Context, p Pending, _ string, e Embedded) error {
+	m.staged[p.ID] = e.Vector
+	return nil
+}
+
+func (m *memReindexStore) SwitchModel(_ context.Context, _, model string) (bool, error) {
+	m.switches++
+	if m.switches == 1 {
+		delete(m.staged, "late")
+		return false, nil
+	}
+	m.model = model
+	return true, nil
+}
+
+func TestReindexer_EmbedsAllIssuesAndSwitches(t *testing.T) {
+	store := &memReindexStore{
+		issues: []Pending{{ID: "1", Title: "a"}, {ID: "2", Title: "b"}, {ID: "late", Title: "c"}},
+		staged: map[string][]float32{},
+	}
+	models := search.Models{Active: "old", Embedders: map[string]search.Embedder{
+		"old": downEmbedder{},
+		"new": textEmbedder{},
+	}}
+	r := NewReindexer(store, models, Options{BatchSize: 2})
+
+	var reports int
+	stats, err := r.Reindex(context.Background(), "demo", "new", func(ReindexStats) { reports++ })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !stats.Switched || store.model != "new" {
+		t.Errorf("expected the repo to be switched to the new model, got %+v", stats)
+	}
+	if stats.Embedded != 4 || reports != 3 {
+		t.Errorf("expected 4 embeddings in 3 batches, got %d in %d", stats.Embedded, reports)
+	}
+}
+
+func TestReindexer_FailedIssueKeepsOldModel(t *testing.T) {
+	store := &memReindexStore{
+		issues: []Pending{{ID: "1", Title: "a"}, {ID: "2", Title: "Dark mode"}},
+		staged: map[string][]float32{},
+	}
+	models := search.Models{Active: "new", Embedders: map[string]search.Embedder{
+		"new": textEmbedder{fail: map[string]bool{"Dark mode\n\n": true}},
+	}}
+
+	stats, err := NewReindexer(store, models, Options{BatchSize: 10}).Reindex(context.Background(), "demo", "", func(ReindexStats) {})
+	if err == nil {
+		t.Fatal("expected the job to fail")
+	}
+	if stats.Switched || store.switches != 0 {
+		t.Errorf("expected no switch, got %+v after %d switches", stats, store.switches)
+	}
+	if _, ok := store.staged["1"]; !ok {
+		t.Error("expected the embedded issue to stay staged for the next run")
+	}
+}
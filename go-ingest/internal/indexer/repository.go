@@ -0,0 +1,277 @@
+package indexer
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zanmajeric/reporadar-go-ingest/utils"
+)
+
+type PgRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgRepository(db *pgxpool.Pool) *PgRepository {
+	return &PgRepository{db: db}
+}
+
+// Claim leases up to n issues without an embedding to the caller. Rows are picked with `FOR UPDATE SKIP LOCKED` and
+// leased until now+lease, so concurrent workers (also in other replicas) never embed the same issue twice. Issues
+// that failed maxAttempts times, or whose retry is not due yet, are skipped, as are issues of unregistered repos.
+func (pgr *PgRepository) Claim(ctx context.Context, n int, lease time.Duration, maxAttempts int) ([]Pending, error) {
+	const qSQL = `
+		UPDATE issues SET embed_claimed_until = now() + $2::interval
+		WHERE id IN (
+			SELECT i.id FROM issues i
+			JOIN repos r ON r.name = i.repo
+			WHERE i.embedding IS NULL AND i.deleted_at IS NULL
+				AND i.embed_attempts < $3
+				AND (i.embed_next_attempt_at IS NULL OR i.embed_next_attempt_at <= now())
+				AND (i.embed_claimed_until IS NULL OR i.embed_claimed_until < now())
+			ORDER BY i.created_at
+			LIMIT $1
+			FOR UPDATE OF i SKIP LOCKED
+		)
+		RETURNING id, repo, title, COALESCE(body, ''), COALESCE(body_format, ''), updated_at, embed_attempts,
+			(SELECT r.embedding_model FROM repos r WHERE r.name = issues.repo)
+	`
+	rows, err := pgr.db.Query(ctx, qSQL, n, lease, maxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Pending
+	for rows.Next() {
+		var p Pending
+		if err := rows.Scan(&p.ID, &p.Repo, &p.Title, &p.Body, &p.BodyFormat, &p.UpdatedAt, &p.Attempts, &p.Model); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, pgr.loadComments(ctx, out)
+}
+
+// loadComments sets the comments of the pending issues.
+func (pgr *PgRepository) loadComments(ctx context.Context, pending []Pending) error {
+	if len(pending) == 0 {
+		return nil
+	}
+	byID := make(map[string]*Pending, len(pending))
+	ids := make([]string, len(pending))
+	for i := range pending {
+		byID[pending[i].ID], ids[i] = &pending[i], pending[i].ID
+	}
+	rows, err := pgr.db.Query(ctx, `
+		SELECT issue_id, id, COALESCE(author, ''), body FROM comments
+		WHERE issue_id = ANY($1)
+		ORDER BY created_at, id
+	`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			issueID string
+			c       PendingComment
+		)
+		if err := rows.Scan(&issueID, &c.ID, &c.Author, &c.Body); err != nil {
+			return err
+		}
+		p := byID[issueID]
+		p.Comments = append(p.Comments, c)
+	}
+	return rows.Err()
+}
+
+// SaveEmbedding stores the vectors unless the issue changed since it was claimed, or its repo switched to another
+// model in the meantime, in which case its lease is released and ErrStale returned.
+func (pgr *PgRepository) SaveEmbedding(ctx context.Context, p Pending, e Embedded) error {
+	tx, err := pgr.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE issues SET
+			embedding = $2::vector,
+			embedding_model = $4,
+			embedding_dim = $5,
+			normalized_body = $6,
+			embed_attempts = 0,
+			embed_error = NULL,
+			embed_next_attempt_at = NULL,
+			embed_claimed_until = NULL
+		WHERE id = $1 AND updated_at = $3
+			AND EXISTS (SELECT 1 FROM repos r WHERE r.name = issues.repo AND r.embedding_model = $4)
+	`, p.ID, utils.EmbeddingToVectorLiteral(e.Vector), p.UpdatedAt, p.Model, len(e.Vector), e.Body)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		if _, err := tx.Exec(ctx, `UPDATE issues SET embed_claimed_until = NULL WHERE id = $1`, p.ID); err != nil {
+			return err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return err
+		}
+		return ErrStale
+	}
+	if err := replaceChunks(ctx, tx, p.ID, p.Model, e.Chunks); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// replaceChunks replaces the chunks of model of an issue.
+func replaceChunks(ctx context.Context, tx pgx.Tx, issueID, model string, chunks []Chunk) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM issue_chunks WHERE issue_id = $1 AND model = $2`, issueID, model); err != nil {
+		return err
+	}
+	indexes := make([]int, len(chunks))
+	kinds := make([]string, len(chunks))
+	texts := make([]string, len(chunks))
+	vectors := make([]string, len(chunks))
+	commentIDs := make([]*string, len(chunks))
+	for i, c := range chunks {
+		indexes[i], kinds[i], texts[i] = c.Index, c.Kind, c.Text
+		vectors[i] = utils.EmbeddingToVectorLiteral(c.Vector)
+		if c.CommentID != "" {
+			commentIDs[i] = &chunks[i].CommentID
+		}
+	}
+	_, err := tx.Exec(ctx, `
+		INSERT INTO issue_chunks (issue_id, model, chunk_index, kind, text, embedding, comment_id)
+		SELECT $1, $2, c.chunk_index, c.kind, c.text, c.embedding::vector, c.comment_id
+		FROM unnest($3::int[], $4::text[], $5::text[], $6::text[], $7::text[])
+			AS c(chunk_index, kind, text, embedding, comment_id)
+	`, issueID, model, indexes, kinds, texts, vectors, commentIDs)
+	return err
+}
+
+// RecordFailure counts a failed attempt and schedules the next one.
+func (pgr *PgRepository) RecordFailure(ctx context.Context, p Pending, cause error, retryAt time.Time) error {
+	_, err := pgr.db.Exec(ctx, `
+		UPDATE issues SET
+			embed_attempts = embed_attempts + 1,
+			embed_error = $2,
+			embed_next_attempt_at = $3,
+			embed_claimed_until = NULL
+		WHERE id = $1
+	`, p.ID, cause.Error(), retryAt)
+	return err
+}
+
+func (pgr *PgRepository) PendingReindex(ctx context.Context, repo, model string, n int) ([]Pending, error) {
+	const qSQL = `
+		SELECT i.id, i.repo, i.title, COALESCE(i.body, ''), COALESCE(i.body_format, ''), i.updated_at
+		FROM issues i
+		LEFT JOIN issue_embeddings e ON e.issue_id = i.id AND e.model = $2
+		WHERE i.repo = $1 AND i.deleted_at IS NULL
+			AND (e.issue_id IS NULL OR e.source_updated_at < i.updated_at)
+		ORDER BY i.created_at, i.id
+		LIMIT $3
+	`
+	rows, err := pgr.db.Query(ctx, qSQL, repo, model, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Pending
+	for rows.Next() {
+		p := Pending{Model: model}
+		if err := rows.Scan(&p.ID, &p.Repo, &p.Title, &p.Body, &p.BodyFormat, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, pgr.loadComments(ctx, out)
+}
+
+func (pgr *PgRepository) SaveReindexed(ctx context.Context, p Pending, model string, e Embedded) error {
+	tx, err := pgr.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO issue_embeddings (issue_id, model, dim, embedding, source_updated_at)
+		VALUES ($1, $2, $3, $4::vector, $5)
+		ON CONFLICT (issue_id, model) DO UPDATE SET
+			dim = EXCLUDED.dim,
+			embedding = EXCLUDED.embedding,
+			source_updated_at = EXCLUDED.source_updated_at
+	`, p.ID, model, len(e.Vector), utils.EmbeddingToVectorLiteral(e.Vector), p.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `UPDATE issues SET normalized_body = $2 WHERE id = $1 AND updated_at = $3`, p.ID, e.Body, p.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if err := replaceChunks(ctx, tx, p.ID, model, e.Chunks); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// SwitchModel runs with the repo row locked, so two re-index jobs of the same repo cannot interleave their switches.
+func (pgr *PgRepository) SwitchModel(ctx context.Context, repo, model string) (bool, error) {
+	tx, err := pgr.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM repos WHERE name = $1 FOR UPDATE`, repo); err != nil {
+		return false, err
+	}
+	// Issue rows are locked as well, ingest cannot change them between the check and the update.
+	var missing int
+	err = tx.QueryRow(ctx, `
+		WITH locked AS (
+			SELECT id, updated_at FROM issues WHERE repo = $1 AND deleted_at IS NULL FOR UPDATE
+		)
+		SELECT count(*) FROM locked i
+		LEFT JOIN issue_embeddings e ON e.issue_id = i.id AND e.model = $2
+		WHERE e.issue_id IS NULL OR e.source_updated_at < i.updated_at
+	`, repo, model).Scan(&missing)
+	if err != nil {
+		return false, err
+	}
+	if missing > 0 {
+		return false, nil
+	}
+
+	for _, q := range []string{
+		`UPDATE issues i SET
+			embedding = e.embedding,
+			embedding_model = e.model,
+			embedding_dim = e.dim,
+			embed_attempts = 0,
+			embed_error = NULL,
+			embed_next_attempt_at = NULL
+		FROM issue_embeddings e
+		WHERE e.issue_id = i.id AND e.model = $2 AND i.repo = $1 AND i.deleted_at IS NULL`,
+		`UPDATE repos SET embedding_model = $2 WHERE name = $1`,
+		`DELETE FROM issue_embeddings WHERE model = $2 AND issue_id IN (SELECT id FROM issues WHERE repo = $1)`,
+		`DELETE FROM issue_chunks WHERE model <> $2 AND issue_id IN (SELECT id FROM issues WHERE repo = $1)`,
+	} {
+		if _, err := tx.Exec(ctx, q, repo, model); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit(ctx)
+}
@@ -0,0 +1,346 @@
+// Package indexer computes the embeddings of stored issues in the background.
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/textnorm"
+)
+
+// Pending is an issue claimed for embedding.
+type Pending struct {
+	ID        string
+	Repo      string
+	Title     string
+	Body      string
+	UpdatedAt time.Time
+	// BodyFormat is the markup of Body when it is not markdown, see textnorm.PlainText.
+	BodyFormat string
+	// Attempts is the number of failed attempts so far.
+	Attempts int
+	// Model is the embedding model of the issue's repo.
+	Model string
+	// Comments are the issue's comments, oldest first.
+	Comments []PendingComment
+}
+
+type PendingComment struct {
+	ID     string
+	Author string
+	Body   string
+}
+
+// How comments are embedded, see Options.Comments.
+const (
+	// CommentsSeparate embeds comments in chunks of their own, so searches can match an issue on one of its comments.
+	CommentsSeparate = "separate"
+	// CommentsFold appends comments to the issue body, they are part of the issue's vector.
+	CommentsFold = "fold"
+	// CommentsOff does not embed comments.
+	CommentsOff = "off"
+)
+
+// ParseCommentMode validates a comment embedding mode, empty means CommentsSeparate.
+func ParseCommentMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return CommentsSeparate, nil
+	case CommentsSeparate, CommentsFold, CommentsOff:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown comment embedding mode %q", mode)
+}
+
+// Embedded is an embedded issue: its normalized body, the chunks of it with their vectors, and the issue's vector,
+// the normalized mean of the chunk vectors.
+type Embedded struct {
+	Body   string
+	Vector []float32
+	Chunks []Chunk
+}
+
+// ErrStale is returned by SaveEmbedding when the issue changed, or its repo switched models, since it was claimed.
+// The issue is released and stays pending, it is embedded again with its current text and model.
+var ErrStale = errors.New("issue changed since it was claimed")
+
+type Store interface {
+	Claim(ctx context.Context, n int, lease time.Duration, maxAttempts int) ([]Pending, error)
+	// SaveEmbedding stores the issue vector and normalized body and replaces the issue's chunks of its model, or
+	// returns ErrStale.
+	SaveEmbedding(ctx context.Context, p Pending, e Embedded) error
+	RecordFailure(ctx context.Context, p Pending, cause error, retryAt time.Time) error
+}
+
+type Options struct {
+	BatchSize    int
+	PollInterval time.Duration
+	MaxAttempts  int
+	// Lease is how long a claimed batch is reserved for this worker.
+	Lease time.Duration
+	// RetryBackoff is the delay before the first retry of a failed issue, it doubles on every further attempt.
+	RetryBackoff time.Duration
+	// ChunkChars is the maximum size of a chunk, DefaultChunkChars when zero.
+	ChunkChars int
+	// Normalizer cleans issue and comment bodies up before they are chunked, nil embeds them as they are.
+	Normalizer *textnorm.Pipeline
+	// Comments is CommentsSeparate, CommentsFold or CommentsOff; comments are not embedded when empty.
+	Comments string
+}
+
+// maxRetryBackoff caps the delay between attempts of one issue.
+const maxRetryBackoff = time.Hour
+
+// Worker embeds issues that have no embedding yet, e.g. after ingest or after their text changed, with the model of
+// their repo.
+type Worker struct {
+	store  Store
+	models search.Models
+	opts   Options
+}
+
+func NewWorker(store Store, models search.Models, opts Options) *Worker {
+	return &Worker{
+		store:  store,
+		models: models,
+		opts:   opts,
+	}
+}
+
+// Run processes batches until ctx is done, polling when there is nothing to embed.
+func (w *Worker) Run(ctx context.Context) {
+	log.Printf("[indexer] started batch=%d poll=%v max_attempts=%d", w.opts.BatchSize, w.opts.PollInterval, w.opts.MaxAttempts)
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		n, err := w.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[indexer] batch failed: %v", err)
+		}
+		if n > 0 && err == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce claims and embeds a single batch, returning how many issues were claimed.
+func (w *Worker) RunOnce(ctx context.Context) (int, error) {
+	batch, err := w.store.Claim(ctx, w.opts.BatchSize, w.opts.Lease, w.opts.MaxAttempts)
+	if err != nil || len(batch) == 0 {
+		return 0, err
+	}
+
+	start := time.Now()
+	var done, stale, failed int
+	for _, group := range groupByModel(batch) {
+		_, embedder, err := w.models.Embedder(group[0].Model)
+		if err != nil {
+			// A configuration problem, not the issues' fault: they are claimed again once the lease expires.
+			return len(batch), err
+		}
+		embedded, itemErrs, err := embedAll(ctx, embedder, group, w.opts)
+		if err != nil {
+			return len(batch), err
+		}
+
+		for i, p := range group {
+			err := itemErrs[i]
+			if err == nil {
+				err = w.store.SaveEmbedding(ctx, p, embedded[i])
+				if err == nil {
+					done++
+					continue
+				}
+				if errors.Is(err, ErrStale) {
+					stale++
+					continue
+				}
+			}
+			if ctx.Err() != nil {
+				return len(batch), ctx.Err()
+			}
+			failed++
+			if err := w.store.RecordFailure(ctx, p, err, time.Now().Add(w.backoff(p.Attempts))); err != nil {
+				return len(batch), err
+			}
+			log.Printf("[indexer] issue=%s repo=%s attempt=%d failed: %v", p.ID, p.Repo, p.Attempts+1, err)
+		}
+	}
+
+	log.Printf("[indexer] batch=%d embedded=%d stale=%d failed=%d time=%v", len(batch), done, stale, failed, time.Since(start))
+	return len(batch), nil
+}
+
+// groupByModel splits a batch into the issues of each embedding model, keeping their order.
+func groupByModel(batch []Pending) [][]Pending {
+	var groups [][]Pending
+	index := map[string]int{}
+	for _, p := range batch {
+		i, ok := index[p.Model]
+		if !ok {
+			i = len(groups)
+			index[p.Model] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], p)
+	}
+	return groups
+}
+
+// errNothingToEmbed fails an issue without any chunk to embed.
+var errNothingToEmbed = errors.New("nothing to embed")
+
+// embedAll normalizes the issues and embeds their chunks in one batch, returning the embedded issues and the errors of the issues
+// that failed; an issue fails when any of its chunks does. It fails as a whole when ctx is done or when the embedder
+// was unavailable for all chunks, which is not the issues' fault: they are left to be claimed again once the lease
+// expires, without using up attempts.
+func embedAll(ctx context.Context, embedder search.Embedder, batch []Pending, opts Options) ([]Embedded, map[int]error, error) {
+	out := make([]Embedded, len(batch))
+	var (
+		texts  []string
+		owners []int
+	)
+	for i, p := range batch {
+		out[i].Body = opts.Normalizer.Normalize(textnorm.PlainText(p.Body, p.BodyFormat))
+		out[i].Chunks = splitWithComments(p, out[i].Body, opts)
+		for _, c := range out[i].Chunks {
+			texts = append(texts, c.Text)
+			owners = append(owners, i)
+		}
+	}
+	vectors, err := embedder.EmbedBatch(ctx, texts)
+	if ctx.Err() != nil {
+		return nil, nil, ctx.Err()
+	}
+	if embedderDown(err, len(texts)) {
+		return nil, nil, err
+	}
+
+	// A BatchError fails only the issues of its items, any other error fails the whole batch.
+	itemErrs := map[int]error{}
+	var batchErr *search.BatchError
+	switch {
+	case err == nil:
+	case errors.As(err, &batchErr):
+		for item, itemErr := range batchErr.Errors {
+			if _, ok := itemErrs[owners[item]]; !ok {
+				itemErrs[owners[item]] = itemErr
+			}
+		}
+	default:
+		for i := range batch {
+			itemErrs[i] = err
+		}
+		return out, itemErrs, nil
+	}
+
+	next := 0
+	for i := range out {
+		for j := range out[i].Chunks {
+			out[i].Chunks[j].Vector = vectors[next]
+			next++
+		}
+		if _, failed := itemErrs[i]; !failed {
+			out[i].Vector = meanVector(out[i].Chunks)
+			if out[i].Vector == nil {
+				itemErrs[i] = errNothingToEmbed
+			}
+		}
+	}
+	return out, itemErrs, nil
+}
+
+// splitWithComments splits the issue with its normalized body into chunks, adding its comments as opts.Comments says.
+func splitWithComments(p Pending, body string, opts Options) []Chunk {
+	if opts.Comments == CommentsFold {
+		for _, c := range p.Comments {
+			if text := opts.Normalizer.Normalize(c.Body); text != "" {
+				body += "\n\n" + text
+			}
+		}
+	}
+	chunks := SplitIssue(p.Title, body, opts.ChunkChars)
+	if opts.Comments != CommentsSeparate {
+		return chunks
+	}
+	for _, c := range p.Comments {
+		chunks = append(chunks, SplitComment(c.ID, opts.Normalizer.Normalize(c.Body), len(chunks), opts.ChunkChars)...)
+	}
+	return chunks
+}
+
+// meanVector is the L2-normalized mean of the vectors of the issue's own chunks, the vector of a single chunk is
+// returned as it is. Separately embedded comments are left out, they do not make the issue similar to other issues,
+// unless the issue has no text of its own. It is nil without chunks.
+func meanVector(chunks []Chunk) []float32 {
+	own := chunks[:0:0]
+	for _, c := range chunks {
+		if c.Kind != ChunkComment {
+			own = append(own, c)
+		}
+	}
+	if len(own) > 0 {
+		chunks = own
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+	if len(chunks) == 1 {
+		return chunks[0].Vector
+	}
+	sum := make([]float64, len(chunks[0].Vector))
+	for _, c := range chunks {
+		for i, v := range c.Vector {
+			sum[i] += float64(v)
+		}
+	}
+	var norm float64
+	for _, v := range sum {
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+	out := make([]float32, len(sum))
+	for i, v := range sum {
+		if norm > 0 {
+			out[i] = float32(v / norm)
+		}
+	}
+	return out
+}
+
+// embedderDown reports whether err says that the embedder was unavailable for all n items of a batch.
+func embedderDown(err error, n int) bool {
+	var batchErr *search.BatchError
+	if !errors.As(err, &batchErr) {
+		return errors.Is(err, search.ErrEmbedderUnavailable)
+	}
+	if len(batchErr.Errors) < n {
+		return false
+	}
+	for _, itemErr := range batchErr.Errors {
+		if !errors.Is(itemErr, search.ErrEmbedderUnavailable) {
+			return false
+		}
+	}
+	return true
+}
+
+// backoff is the jittered delay before the next attempt of an issue that failed attempts times before.
+func (w *Worker) backoff(attempts int) time.Duration {
+	d := w.opts.RetryBackoff << min(attempts, 16)
+	if d <= 0 || d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,339 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/textnorm"
+)
+
+type memStore struct {
+	pending []Pending
+	saved   map[string][]float32
+	chunks  map[string][]Chunk
+	failed  map[string]time.Time
+	// stale are the issues changed after they were claimed.
+	stale map[string]bool
+}
+
+func (m *memStore) Claim(_ context.Context, n int, _ time.Duration, _ int) ([]Pending, error) {
+	batch := m.pending[:min(n, len(m.pending))]
+	m.pending = m.pending[len(batch):]
+	return batch, nil
+}
+
+func (m *memStore) SaveEmbedding(_ context.Context, p Pending, e Embedded) error {
+	if m.stale[p.ID] {
+		return ErrStale
+	}
+	m.saved[p.ID] = e.Vector
+	if m.chunks != nil {
+		m.chunks[p.ID] = e.Chunks
+	}
+	return nil
+}
+
+func (m *memStore) RecordFailure(_ context.Context, p Pending, _ error, retryAt time.Time) error {
+	m.failed[p.ID] = retryAt
+	return nil
+}
+
+// textEmbedder fails for texts listed in fail and embeds everything else into a single dimension.
+type textEmbedder struct {
+	fail map[string]bool
+}
+
+func (e textEmbedder) Embed(_ context.Context, text string) ([]float32, error) {
+	if e.fail[text] {
+		return nil, errors.New("embedder down")
+	}
+	return []float32{float32(len(text))}, nil
+}
+
+func (e textEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	failed := map[int]error{}
+	for i, text := range texts {
+		vec, err := e.Embed(ctx, text)
+		if err != nil {
+			failed[i] = err
+		}
+		out[i] = vec
+	}
+	if len(failed) > 0 {
+		return out, &search.BatchError{Errors: failed}
+	}
+	return out, nil
+}
+
+func TestWorker_RunOnceEmbedsAndRecordsFailures(t *testing.T) {
+	store := &memStore{
+		pending: []Pending{
+			{ID: "1", Title: "App crashes on login", Body: "500"},
+			{ID: "2", Title: "Dark mode", Body: "", Attempts: 2},
+			{ID: "3", Title: "Not in this batch"},
+		},
+		saved:  map[string][]float32{},
+		failed: map[string]time.Time{},
+	}
+	emb := textEmbedder{fail: map[string]bool{"Dark mode\n\n": true}}
+	w := NewWorker(store, search.SingleModel("m", emb), Options{BatchSize: 2, MaxAttempts: 5, RetryBackoff: time.Minute})
+
+	n, err := w.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected a batch of 2, got %d", n)
+	}
+	if _, ok := store.saved["1"]; !ok {
+		t.Error("expected issue 1 to be embedded")
+	}
+	retryAt, ok := store.failed["2"]
+	if !ok {
+		t.Fatal("expected the failure of issue 2 to be recorded")
+	}
+	// third attempt: backoff of 4 minutes, jittered into [2m, 4m]
+	if d := time.Until(retryAt); d < 119*time.Second || d > 4*time.Minute {
+		t.Errorf("unexpected retry delay %v", d)
+	}
+	if len(store.pending) != 1 {
+		t.Errorf("expected one issue left pending, got %d", len(store.pending))
+	}
+}
+
+func TestWorker_RunOnceSkipsStaleIssues(t *testing.T) {
+	store := &memStore{
+		pending: []Pending{{ID: "1", Title: "App crashes on login"}, {ID: "2", Title: "Dark mode"}},
+		saved:   map[string][]float32{},
+		failed:  map[string]time.Time{},
+		stale:   map[string]bool{"2": true},
+	}
+	w := NewWorker(store, search.SingleModel("m", textEmbedder{}), Options{BatchSize: 2, MaxAttempts: 5, RetryBackoff: time.Minute})
+
+	if _, err := w.RunOnce(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := store.saved["1"]; !ok || len(store.saved) != 1 {
+		t.Errorf("expected only issue 1 to be embedded, got %v", store.saved)
+	}
+	if len(store.failed) != 0 {
+		t.Errorf("expected a stale issue not to count as failed, got %v", store.failed)
+	}
+}
+
+func TestWorker_RunOnceFailsWholeBatchOnEmbedderError(t *testing.T) {
+	store := &memStore{
+		pending: []Pending{{ID: "1", Title: "a"}, {ID: "2", Title: "b"}},
+		saved:   map[string][]float32{},
+		failed:  map[string]time.Time{},
+	}
+	w := NewWorker(store, search.SingleModel("m", downEmbedder{}), Options{BatchSize: 2, MaxAttempts: 5, RetryBackoff: time.Minute})
+
+	if _, err := w.RunOnce(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.saved) != 0 || len(store.failed) != 2 {
+		t.Errorf("expected both issues to fail, got saved=%d failed=%d", len(store.saved), len(store.failed))
+	}
+}
+
+func TestWorker_RunOnceKeepsAttemptsWhileEmbedderIsUnavailable(t *testing.T) {
+	store := &memStore{
+		pending: []Pending{{ID: "1", Title: "a"}},
+		saved:   map[string][]float32{},
+		failed:  map[string]time.Time{},
+	}
+	w := NewWorker(store, search.SingleModel("m", unavailableEmbedder{}), Options{BatchSize: 2, MaxAttempts: 5, RetryBackoff: time.Minute})
+
+	if _, err := w.RunOnce(context.Background()); !errors.Is(err, search.ErrEmbedderUnavailable) {
+		t.Fatalf("expected ErrEmbedderUnavailable, got %v", err)
+	}
+	if len(store.failed) != 0 {
+		t.Errorf("expected no failure to be recorded, got %v", store.failed)
+	}
+}
+
+// unavailableEmbedder fails every item as if its circuit breaker was open.
+type unavailableEmbedder struct{ downEmbedder }
+
+func (unavailableEmbedder) EmbedBatch(_ context.Context, texts []string) ([][]float32, error) {
+	failed := map[int]error{}
+	for i := range texts {
+		failed[i] = fmt.Errorf("%w: circuit open", search.ErrEmbedderUnavailable)
+	}
+	return make([][]float32, len(texts)), &search.BatchError{Errors: failed}
+}
+
+// downEmbedder fails every request.
+type downEmbedder struct{}
+
+func (downEmbedder) Embed(context.Context, string) ([]float32, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (downEmbedder) EmbedBatch(context.Context, []string) ([][]float32, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestWorker_RunOnceEmbedsWithModelOfRepo(t *testing.T) {
+	store := &memStore{
+		pending: []Pending{{ID: "1", Title: "a", Model: "old"}, {ID: "2", Title: "b", Model: "new"}},
+		saved:   map[string][]float32{},
+		failed:  map[string]time.Time{},
+	}
+	models := search.Models{Active: "new", Embedders: map[string]search.Embedder{
+		"old": textEmbedder{},
+		"new": downEmbedder{},
+	}}
+	w := NewWorker(store, models, Options{BatchSize: 2, MaxAttempts: 5, RetryBackoff: time.Minute})
+
+	if _, err := w.RunOnce(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := store.saved["1"]; !ok {
+		t.Error("expected issue 1 to be embedded with the old model")
+	}
+	if _, ok := store.failed["2"]; !ok {
+		t.Error("expected issue 2 to fail with the new model")
+	}
+}
+
+func TestWorker_RunOnceEmbedsChunksOfLongIssues(t *testing.T) {
+	store := &memStore{
+		pending: []Pending{
+			{ID: "long", Title: "Crash", Body: "aaaa\n\nbbbbbbbb"},
+			{ID: "broken", Title: "Crash", Body: "aaaa\n\nfailing"},
+		},
+		saved:  map[string][]float32{},
+		chunks: map[string][]Chunk{},
+		failed: map[string]time.Time{},
+	}
+	emb := textEmbedder{fail: map[string]bool{"failing": true}}
+	w := NewWorker(store, search.SingleModel("m", emb), Options{BatchSize: 2, MaxAttempts: 5, RetryBackoff: time.Minute, ChunkChars: 12})
+
+	if _, err := w.RunOnce(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	chunks := store.chunks["long"]
+	if len(chunks) != 2 || chunks[0].Text != "Crash\n\naaaa" || chunks[1].Text != "bbbbbbbb" {
+		t.Fatalf("expected two chunks, got %+v", chunks)
+	}
+	// Both chunk vectors are positive in the single dimension, their normalized mean is 1.
+	if vec := store.saved["long"]; len(vec) != 1 || vec[0] != 1 {
+		t.Errorf("expected the normalized mean of the chunks, got %v", vec)
+	}
+	if _, ok := store.failed["broken"]; !ok {
+		t.Error("expected issue broken to fail with its last chunk")
+	}
+}
+
+func TestWorker_RunOnceEmbedsNormalizedBody(t *testing.T) {
+	store := &memStore{
+		pending: []Pending{{ID: "1", Title: "Crash", Body: "<!-- template -->\nPanics ![img](a.png) on login"}},
+		saved:   map[string][]float32{},
+		chunks:  map[string][]Chunk{},
+		failed:  map[string]time.Time{},
+	}
+	norm, err := textnorm.New(textnorm.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWorker(store, search.SingleModel("m", textEmbedder{}), Options{BatchSize: 1, Normalizer: norm})
+
+	if _, err := w.RunOnce(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if chunks := store.chunks["1"]; len(chunks) != 1 || chunks[0].Text != "Crash\n\nPanics on login" {
+		t.Errorf("expected the normalized body to be embedded, got %+v", chunks)
+	}
+}
+
+func TestWorker_RunOnceEmbedsJiraIssuesAsPlainText(t *testing.T) {
+	store := &memStore{
+		pending: []Pending{
+			{ID: "jira:10001", Title: "Crash", Body: "h2. Steps\n* open *login*", BodyFormat: textnorm.FormatJiraWiki},
+			{ID: "2", Title: "Crash", Body: "* open *login*"},
+		},
+		saved:  map[string][]float32{},
+		chunks: map[string][]Chunk{},
+		failed: map[string]time.Time{},
+	}
+	w := NewWorker(store, search.SingleModel("m", textEmbedder{}), Options{BatchSize: 2})
+
+	if _, err := w.RunOnce(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if chunks := store.chunks["jira:10001"]; len(chunks) != 1 || chunks[0].Text != "Crash\n\nSteps\n- open login" {
+		t.Errorf("expected the wiki markup to be converted, got %+v", chunks)
+	}
+	if chunks := store.chunks["2"]; len(chunks) != 1 || chunks[0].Text != "Crash\n\n* open *login*" {
+		t.Errorf("expected other bodies to be embedded as they are, got %+v", chunks)
+	}
+}
+
+func TestWorker_RunOnceEmbedsComments(t *testing.T) {
+	comments := []PendingComment{{ID: "c1", Body: "Same here"}, {ID: "c2", Body: "Fixed by a restart"}}
+	for _, tc := range []struct {
+		mode  string
+		texts []string
+	}{
+		{CommentsSeparate, []string{"Crash\n\nboom", "Same here", "Fixed by a restart"}},
+		{CommentsFold, []string{"Crash\n\nboom\n\nSame here\n\nFixed by a restart"}},
+		{CommentsOff, []string{"Crash\n\nboom"}},
+	} {
+		store := &memStore{
+			pending: []Pending{{ID: "1", Title: "Crash", Body: "boom", Comments: comments}},
+			saved:   map[string][]float32{},
+			chunks:  map[string][]Chunk{},
+			failed:  map[string]time.Time{},
+		}
+		w := NewWorker(store, search.SingleModel("m", textEmbedder{}), Options{BatchSize: 1, Comments: tc.mode})
+
+		if _, err := w.RunOnce(context.Background()); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.mode, err)
+		}
+		chunks := store.chunks["1"]
+		var texts []string
+		for _, c := range chunks {
+			texts = append(texts, c.Text)
+		}
+		if !slices.Equal(texts, tc.texts) {
+			t.Errorf("%s: expected chunks %q, got %q", tc.mode, tc.texts, texts)
+			continue
+		}
+		// The issue vector is that of its first chunk, separately embedded comments are not part of it.
+		if vec := store.saved["1"]; len(vec) != 1 || vec[0] != float32(len(tc.texts[0])) {
+			t.Errorf("%s: expected the vector of the issue text, got %v", tc.mode, vec)
+		}
+		if tc.mode == CommentsSeparate && (chunks[1].Kind != ChunkComment || chunks[2].CommentID != "c2" || chunks[2].Index != 2) {
+			t.Errorf("expected comment chunks, got %+v", chunks)
+		}
+	}
+}
+
+func TestWorker_BackoffIsCapped(t *testing.T) {
+	w := NewWorker(nil, search.Models{}, Options{RetryBackoff: time.Minute})
+
+	if d := w.backoff(30); d > maxRetryBackoff || d < maxRetryBackoff/2 {
+		t.Errorf("expected backoff within [%v, %v], got %v", maxRetryBackoff/2, maxRetryBackoff, d)
+	}
+}
+
+func TestMeanVector_FallsBackToCommentChunks(t *testing.T) {
+	comments := []Chunk{
+		{Kind: ChunkComment, Vector: []float32{1, 0}},
+		{Kind: ChunkComment, Vector: []float32{0, 1}},
+	}
+	if vec := meanVector(comments); len(vec) != 2 || vec[0] != vec[1] || vec[0] <= 0 {
+		t.Errorf("expected the normalized mean of the comment chunks, got %v", vec)
+	}
+	if vec := meanVector(nil); vec != nil {
+		t.Errorf("expected no vector without chunks, got %v", vec)
+	}
+}
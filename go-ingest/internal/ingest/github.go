@@ -0,0 +1,328 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+type GithubSource struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+	// TimelineLimit is how many of the issues changed since the last sync have their timelines read for cross-references
+	// by pull requests, the most recently updated first. Every timeline costs a request, so none are read when it is 0
+	// and on full syncs, which rely on the closing keywords of pull requests.
+	TimelineLimit int
+}
+
+func NewGithubSource(baseURL, token string) *GithubSource {
+	return &GithubSource{
+		BaseURL: baseURL,
+		Token:   token,
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+type githubLabel struct {
+	Name string `json:"name"`
+}
+
+type githubUser struct {
+	Login string `json:"login"`
+}
+
+type githubMilestone struct {
+	Title string `json:"title"`
+}
+
+// githubPullRef is the pull_request field that tells pull requests apart from issues in the issues endpoint.
+type githubPullRef struct {
+	HTMLURL  string     `json:"html_url"`
+	MergedAt *time.Time `json:"merged_at"`
+}
+
+type githubTimelineEvent struct {
+	Event  string `json:"event"`
+	Source *struct {
+		Issue struct {
+			Number      int            `json:"number"`
+			PullRequest *githubPullRef `json:"pull_request"`
+			Repository  struct {
+				FullName string `json:"full_name"`
+			} `json:"repository"`
+		} `json:"issue"`
+	} `json:"source"`
+}
+
+type githubIssue struct {
+	ID          int64            `json:"id"`
+	Number      int              `json:"number"`
+	Title       string           `json:"title"`
+	Body        string           `json:"body"`
+	Labels      []githubLabel    `json:"labels"`
+	State       string           `json:"state"`
+	User        githubUser       `json:"user"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	PullRequest *githubPullRef   `json:"pull_request"`
+	Assignees   []githubUser     `json:"assignees"`
+	Milestone   *githubMilestone `json:"milestone"`
+	ClosedAt    *time.Time       `json:"closed_at"`
+	// StateReason is completed, not_planned, duplicate or reopened.
+	StateReason string `json:"state_reason"`
+}
+
+type githubComment struct {
+	ID        int64      `json:"id"`
+	IssueURL  string     `json:"issue_url"`
+	Body      string     `json:"body"`
+	User      githubUser `json:"user"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// linkNextRe extracts the rel="next" URL from a GitHub `Link` response header.
+var linkNextRe = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// FetchIssues pages through GET /repos/{repo}/issues. The endpoint also lists pull requests, which are returned as
+// such.
+// Issues updated before the state watermark are filtered upstream with `since`, and the first page is requested
+// conditionally with the stored ETag, so an unchanged repo costs a single 304 that does not count against rate limit.
+// Comments changed since the watermark are fetched afterwards from GET /repos/{repo}/issues/comments, and pull
+// requests cross-referencing the fetched issues from their timelines, see TimelineLimit.
+func (g *GithubSource) FetchIssues(ctx context.Context, repo string, state SyncState) (FetchResult, error) {
+	q := url.Values{}
+	q.Set("state", "all")
+	q.Set("per_page", "100")
+	q.Set("sort", "updated")
+	q.Set("direction", "asc")
+	if !state.LastUpdatedAt.IsZero() {
+		q.Set("since", state.LastUpdatedAt.UTC().Format(time.RFC3339))
+	}
+	next := fmt.Sprintf("%s/repos/%s/issues?%s", g.BaseURL, repo, q.Encode())
+
+	var res FetchResult
+	for page := 1; next != ""; page++ {
+		etag := ""
+		if page == 1 {
+			etag = state.ETag
+		}
+		var issues []githubIssue
+		resp, err := g.get(ctx, next, etag, &issues)
+		if err != nil {
+			return res, fmt.Errorf("github page %d: %w", page, err)
+		}
+		if resp.StatusCode == http.StatusNotModified {
+			res.NotModified = true
+			return res, nil
+		}
+		if page == 1 {
+			res.ETag = resp.Header.Get("ETag")
+		}
+		for _, gi := range issues {
+			if gi.PullRequest != nil {
+				res.PullRequests = append(res.PullRequests, gi.toPullRequest(repo))
+				continue
+			}
+			res.Issues = append(res.Issues, gi.toRow(repo))
+		}
+		log.Printf("[github] repo=%s page=%d items=%d", repo, page, len(issues))
+
+		next = nextPage(resp)
+	}
+
+	comments, err := g.fetchComments(ctx, repo, state.LastUpdatedAt)
+	if err != nil {
+		return res, err
+	}
+	res.Comments = comments
+
+	if state.LastUpdatedAt.IsZero() || g.TimelineLimit <= 0 {
+		return res, nil
+	}
+	for _, iss := range res.Issues[max(len(res.Issues)-g.TimelineLimit, 0):] {
+		links, err := g.fetchTimelineLinks(ctx, repo, iss.Number)
+		if err != nil {
+			return res, err
+		}
+		res.Links = append(res.Links, links...)
+	}
+	return res, nil
+}
+
+// fetchTimelineLinks returns links to the pull requests of repo that cross-reference the issue, from GET
+// /repos/{repo}/issues/{number}/timeline.
+func (g *GithubSource) fetchTimelineLinks(ctx context.Context, repo string, number int) ([]Link, error) {
+	next := fmt.Sprintf("%s/repos/%s/issues/%d/timeline?per_page=100", g.BaseURL, repo, number)
+	var out []Link
+	for page := 1; next != ""; page++ {
+		var events []githubTimelineEvent
+		resp, err := g.get(ctx, next, "", &events)
+		if err != nil {
+			return out, fmt.Errorf("github timeline of #%d page %d: %w", number, page, err)
+		}
+		for _, ev := range events {
+			if ev.Event != "cross-referenced" || ev.Source == nil {
+				continue
+			}
+			src := ev.Source.Issue
+			if src.PullRequest == nil || !strings.EqualFold(src.Repository.FullName, repo) {
+				continue
+			}
+			out = append(out, Link{IssueNumber: number, PRNumber: src.Number, Source: LinkTimeline})
+		}
+		next = nextPage(resp)
+	}
+	return out, nil
+}
+
+// fetchComments pages through the comments of all issues (and pull requests) of repo updated since the watermark.
+// Comments only carry the URL of their issue, so they refer to it by number.
+func (g *GithubSource) fetchComments(ctx context.Context, repo string, since time.Time) ([]Comment, error) {
+	q := url.Values{}
+	q.Set("per_page", "100")
+	q.Set("sort", "updated")
+	q.Set("direction", "asc")
+	if !since.IsZero() {
+		q.Set("since", since.UTC().Format(time.RFC3339))
+	}
+	next := fmt.Sprintf("%s/repos/%s/issues/comments?%s", g.BaseURL, repo, q.Encode())
+
+	var out []Comment
+	for page := 1; next != ""; page++ {
+		var comments []githubComment
+		resp, err := g.get(ctx, next, "", &comments)
+		if err != nil {
+			return out, fmt.Errorf("github comments page %d: %w", page, err)
+		}
+		for _, gc := range comments {
+			number, err := strconv.Atoi(path.Base(gc.IssueURL))
+			if err != nil {
+				continue
+			}
+			out = append(out, Comment{
+				ID:          strconv.FormatInt(gc.ID, 10),
+				Repo:        repo,
+				IssueNumber: number,
+				Author:      gc.User.Login,
+				Body:        gc.Body,
+				CreatedAt:   gc.CreatedAt,
+				UpdatedAt:   gc.UpdatedAt,
+			})
+		}
+		log.Printf("[github] repo=%s comments page=%d items=%d", repo, page, len(comments))
+		next = nextPage(resp)
+	}
+	return out, nil
+}
+
+// nextPage returns the rel="next" URL of a paginated response, or "" on the last page.
+func nextPage(resp *http.Response) string {
+	if m := linkNextRe.FindStringSubmatch(resp.Header.Get("Link")); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// get decodes the response body into target. A 304 answer to a conditional request is returned without decoding.
+func (g *GithubSource) get(ctx context.Context, url, etag string, target any) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := g.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && etag != "" {
+		return resp, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return resp, nil
+}
+
+func (gi githubIssue) toRow(repo string) search.IssueRow {
+	labels := make([]string, 0, len(gi.Labels))
+	for _, l := range gi.Labels {
+		labels = append(labels, l.Name)
+	}
+	var assignees []string
+	for _, a := range gi.Assignees {
+		assignees = append(assignees, a.Login)
+	}
+	iss := search.IssueRow{
+		ID:        strconv.FormatInt(gi.ID, 10),
+		Repo:      repo,
+		Number:    gi.Number,
+		Title:     gi.Title,
+		Body:      gi.Body,
+		Labels:    labels,
+		State:     gi.State,
+		Author:    gi.User.Login,
+		Assignees: assignees,
+		CreatedAt: gi.CreatedAt,
+		UpdatedAt: gi.UpdatedAt,
+	}
+	if gi.Milestone != nil {
+		iss.Milestone = gi.Milestone.Title
+	}
+	// Reopened issues keep their last closed_at, only closed ones report it.
+	if gi.State == "closed" {
+		iss.ClosedAt = gi.ClosedAt
+		iss.CloseReason = gi.StateReason
+		if iss.CloseReason == "" {
+			// Closed before GitHub recorded reasons, or closed through the API without one.
+			iss.CloseReason = search.CloseReasonCompleted
+		}
+	}
+	return iss
+}
+
+func (gi githubIssue) toPullRequest(repo string) PullRequest {
+	pr := PullRequest{
+		ID:        strconv.FormatInt(gi.ID, 10),
+		Repo:      repo,
+		Number:    gi.Number,
+		Title:     gi.Title,
+		Body:      gi.Body,
+		State:     gi.State,
+		Author:    gi.User.Login,
+		URL:       gi.PullRequest.HTMLURL,
+		CreatedAt: gi.CreatedAt,
+		UpdatedAt: gi.UpdatedAt,
+		MergedAt:  gi.PullRequest.MergedAt,
+	}
+	if pr.MergedAt != nil {
+		pr.State = "merged"
+	}
+	return pr
+}
@@ -0,0 +1,233 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGithubSource_FetchIssuesPaginatesAndSeparatesPullRequests(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("expected bearer token, got %q", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/repos/demo/reporadar/issues":
+		case "/repos/demo/reporadar/issues/comments", "/repos/demo/reporadar/issues/1/timeline",
+			"/repos/demo/reporadar/issues/3/timeline":
+			fmt.Fprint(w, `[]`)
+			return
+		default:
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/demo/reporadar/issues?page=2>; rel="next", <%s/repos/demo/reporadar/issues?page=2>; rel="last"`, srv.URL, srv.URL))
+			fmt.Fprint(w, `[
+				{"id": 101, "number": 1, "title": "App crashes on login", "body": "500 on Google login",
+				 "labels": [{"name": "bug"}], "created_at": "2024-11-01T10:15:00Z", "updated_at": "2024-11-02T10:15:00Z"},
+				{"id": 102, "number": 2, "title": "Fix login", "body": "", "labels": [],
+				 "created_at": "2024-11-01T11:00:00Z", "updated_at": "2024-11-01T11:00:00Z", "pull_request": {"url": "x"}}
+			]`)
+		case "2":
+			fmt.Fprint(w, `[
+				{"id": 103, "number": 3, "title": "Dark mode", "body": null, "labels": [{"name": "enhancement"}, {"name": "ux"}],
+				 "state": "closed", "state_reason": "not_planned", "closed_at": "2024-11-03T09:00:00Z",
+				 "assignees": [{"login": "octocat"}], "milestone": {"title": "v2.0"},
+				 "created_at": "2024-11-03T09:00:00Z", "updated_at": "2024-11-03T09:00:00Z"}
+			]`)
+		default:
+			t.Errorf("unexpected page %q", r.URL.Query().Get("page"))
+		}
+	}))
+	defer srv.Close()
+
+	src := NewGithubSource(srv.URL, "secret")
+	res, err := src.FetchIssues(context.Background(), "demo/reporadar", SyncState{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := res.Issues
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 issues (pull request returned separately), got %d", len(got))
+	}
+	if len(res.PullRequests) != 1 || res.PullRequests[0].Number != 2 {
+		t.Errorf("expected pull request #2, got %+v", res.PullRequests)
+	}
+	if got[0].ID != "101" || got[0].Number != 1 || got[0].Repo != "demo/reporadar" {
+		t.Errorf("unexpected first issue: %+v", got[0])
+	}
+	if len(got[0].Labels) != 1 || got[0].Labels[0] != "bug" {
+		t.Errorf("expected labels [bug], got %v", got[0].Labels)
+	}
+	if got[0].UpdatedAt.Format("2006-01-02") != "2024-11-02" {
+		t.Errorf("unexpected updated_at %v", got[0].UpdatedAt)
+	}
+	if got[1].ID != "103" || len(got[1].Labels) != 2 {
+		t.Errorf("unexpected second issue: %+v", got[1])
+	}
+	if got[0].ClosedAt != nil || got[0].CloseReason != "" {
+		t.Errorf("expected an open issue without closure, got %+v", got[0])
+	}
+	if got[1].CloseReason != "not_planned" || got[1].ClosedAt == nil || got[1].Milestone != "v2.0" ||
+		len(got[1].Assignees) != 1 || got[1].Assignees[0] != "octocat" {
+		t.Errorf("unexpected lifecycle of second issue: %+v", got[1])
+	}
+}
+
+func TestGithubSource_FetchIssuesFetchesComments(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/repos/demo/reporadar/issues":
+			fmt.Fprint(w, `[]`)
+		case r.URL.Path == "/repos/demo/reporadar/issues/comments" && r.URL.Query().Get("page") == "":
+			if got := r.URL.Query().Get("since"); got != "2024-11-02T10:15:00Z" {
+				t.Errorf("expected since watermark, got %q", got)
+			}
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/demo/reporadar/issues/comments?page=2>; rel="next"`, srv.URL))
+			fmt.Fprint(w, `[{"id": 9001, "issue_url": "https://api.github.com/repos/demo/reporadar/issues/1",
+				"body": "Same here after updating to 2.3", "user": {"login": "octocat"},
+				"created_at": "2024-11-03T10:00:00Z", "updated_at": "2024-11-03T10:00:00Z"}]`)
+		case r.URL.Path == "/repos/demo/reporadar/issues/comments":
+			fmt.Fprint(w, `[{"id": 9002, "issue_url": "https://api.github.com/repos/demo/reporadar/issues/7",
+				"body": "Fixed by clearing the cache", "user": {"login": "hubot"},
+				"created_at": "2024-11-04T10:00:00Z", "updated_at": "2024-11-05T10:00:00Z"}]`)
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+		}
+	}))
+	defer srv.Close()
+
+	since := time.Date(2024, 11, 2, 10, 15, 0, 0, time.UTC)
+	res, err := NewGithubSource(srv.URL, "").FetchIssues(context.Background(), "demo/reporadar", SyncState{LastUpdatedAt: since})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Comments) != 2 {
+		t.Fatalf("expected 2 comments, got %+v", res.Comments)
+	}
+	c := res.Comments[0]
+	if c.ID != "9001" || c.Repo != "demo/reporadar" || c.IssueNumber != 1 || c.Author != "octocat" || c.Body == "" {
+		t.Errorf("unexpected first comment: %+v", c)
+	}
+	if res.Comments[1].IssueNumber != 7 || res.Comments[1].UpdatedAt.Format("2006-01-02") != "2024-11-05" {
+		t.Errorf("unexpected second comment: %+v", res.Comments[1])
+	}
+}
+
+func TestGithubSource_FetchIssuesLinksPullRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/repos/demo/reporadar/issues":
+			fmt.Fprint(w, `[
+				{"id": 101, "number": 1, "title": "App crashes on login", "labels": [], "state": "open",
+				 "created_at": "2024-11-01T10:15:00Z", "updated_at": "2024-11-02T10:15:00Z"},
+				{"id": 102, "number": 2, "title": "Fix login", "body": "Fixes #1", "labels": [], "state": "closed",
+				 "created_at": "2024-11-01T11:00:00Z", "updated_at": "2024-11-03T11:00:00Z",
+				 "pull_request": {"html_url": "https://github.com/demo/reporadar/pull/2", "merged_at": "2024-11-03T11:00:00Z"}}
+			]`)
+		case "/repos/demo/reporadar/issues/comments":
+			fmt.Fprint(w, `[]`)
+		case "/repos/demo/reporadar/issues/1/timeline":
+			fmt.Fprint(w, `[
+				{"event": "labeled"},
+				{"event": "cross-referenced", "source": {"issue": {"number": 5, "pull_request": {"html_url": "x"},
+					"repository": {"full_name": "demo/reporadar"}}}},
+				{"event": "cross-referenced", "source": {"issue": {"number": 6,
+					"repository": {"full_name": "demo/reporadar"}}}},
+				{"event": "cross-referenced", "source": {"issue": {"number": 9, "pull_request": {"html_url": "x"},
+					"repository": {"full_name": "other/fork"}}}}
+			]`)
+		default:
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	src := NewGithubSource(srv.URL, "")
+	src.TimelineLimit = 1
+	since := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	res, err := src.FetchIssues(context.Background(), "demo/reporadar", SyncState{LastUpdatedAt: since})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.PullRequests) != 1 {
+		t.Fatalf("expected one pull request, got %+v", res.PullRequests)
+	}
+	pr := res.PullRequests[0]
+	if pr.State != "merged" || pr.MergedAt == nil || pr.URL != "https://github.com/demo/reporadar/pull/2" || pr.Body != "Fixes #1" {
+		t.Errorf("unexpected pull request: %+v", pr)
+	}
+	// Only the cross-reference by a pull request of the same repo is a link.
+	if len(res.Links) != 1 || res.Links[0] != (Link{IssueNumber: 1, PRNumber: 5, Source: LinkTimeline}) {
+		t.Errorf("expected a timeline link to #5, got %+v", res.Links)
+	}
+
+	// Full syncs do not read timelines.
+	if res, err := src.FetchIssues(context.Background(), "demo/reporadar", SyncState{}); err != nil || len(res.Links) != 0 {
+		t.Errorf("expected no timeline links on a full sync, got %+v, %v", res.Links, err)
+	}
+}
+
+func TestGithubSource_FetchIssuesFailsOnErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	_, err := NewGithubSource(srv.URL, "").FetchIssues(context.Background(), "demo/missing", SyncState{})
+	if err == nil {
+		t.Fatal("expected an error for 404 response")
+	}
+}
+
+func TestGithubSource_FetchIssuesIncremental(t *testing.T) {
+	since := time.Date(2024, 11, 2, 10, 15, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/demo/reporadar/issues/1/timeline" {
+			fmt.Fprint(w, `[]`)
+			return
+		}
+		if got := r.URL.Query().Get("since"); got != "2024-11-02T10:15:00Z" {
+			t.Errorf("expected since watermark, got %q", got)
+		}
+		if r.URL.Path == "/repos/demo/reporadar/issues/comments" {
+			fmt.Fprint(w, `[]`)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v2"`)
+		fmt.Fprint(w, `[{"id": 101, "number": 1, "title": "App crashes on login", "labels": [],
+			"created_at": "2024-11-01T10:15:00Z", "updated_at": "2024-11-05T08:00:00Z"}]`)
+	}))
+	defer srv.Close()
+	src := NewGithubSource(srv.URL, "")
+
+	res, err := src.FetchIssues(context.Background(), "demo/reporadar", SyncState{LastUpdatedAt: since, ETag: `"v1"`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.NotModified || len(res.Issues) != 0 {
+		t.Errorf("expected not modified without issues, got %+v", res)
+	}
+
+	res, err = src.FetchIssues(context.Background(), "demo/reporadar", SyncState{LastUpdatedAt: since, ETag: `"stale"`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.NotModified || len(res.Issues) != 1 || res.ETag != `"v2"` {
+		t.Errorf("expected one changed issue with new etag, got %+v", res)
+	}
+}
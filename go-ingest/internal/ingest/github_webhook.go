@@ -0,0 +1,103 @@
+package ingest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/stacktrace"
+)
+
+// Delivery identifies a single webhook delivery, see the X-GitHub-Delivery header.
+type Delivery struct {
+	ID     string
+	Repo   string
+	Event  string
+	Action string
+}
+
+type GithubIssueEvent struct {
+	Action     string      `json:"action"`
+	Issue      githubIssue `json:"issue"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// githubIssueActions are the `issues` event actions that change a stored issue.
+var githubIssueActions = map[string]bool{
+	"opened":       true,
+	"edited":       true,
+	"closed":       true,
+	"reopened":     true,
+	"deleted":      true,
+	"labeled":      true,
+	"unlabeled":    true,
+	"assigned":     true,
+	"unassigned":   true,
+	"milestoned":   true,
+	"demilestoned": true,
+}
+
+// WebhookRepo returns the full name of the repository a webhook payload was sent for.
+func WebhookRepo(payload []byte) (string, error) {
+	var p struct {
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return "", fmt.Errorf("invalid json structure: %w", err)
+	}
+	if p.Repository.FullName == "" {
+		return "", fmt.Errorf("payload has no repository")
+	}
+	return p.Repository.FullName, nil
+}
+
+// VerifyGithubSignature checks the `X-Hub-Signature-256` header, an HMAC-SHA256 of the payload keyed with the
+// webhook secret.
+func VerifyGithubSignature(secret string, payload []byte, signature string) bool {
+	sig, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok || secret == "" {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// HandleGithubIssueEvent applies an `issues` webhook event. It returns false when the action is not relevant or the
+// delivery was already processed.
+func (s *Service) HandleGithubIssueEvent(ctx context.Context, deliveryID string, payload []byte) (bool, error) {
+	var ev GithubIssueEvent
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return false, fmt.Errorf("invalid json structure: %w", err)
+	}
+	if !githubIssueActions[ev.Action] {
+		return false, nil
+	}
+	if ev.Issue.PullRequest != nil {
+		return false, nil
+	}
+
+	repo := ev.Repository.FullName
+	d := Delivery{ID: deliveryID, Repo: repo, Event: "issues", Action: ev.Action}
+	iss := ev.Issue.toRow(repo)
+	iss.Fingerprint = stacktrace.Fingerprint(iss.Body)
+	applied, err := s.store.ApplyWebhook(ctx, d, iss, ev.Action == "deleted")
+	if err != nil {
+		return false, fmt.Errorf("db error: %w", err)
+	}
+	log.Printf("[webhook] repo=%s delivery=%s action=%s issue=%d applied=%v", repo, deliveryID, ev.Action, ev.Issue.Number, applied)
+	return applied, nil
+}
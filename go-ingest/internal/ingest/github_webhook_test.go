@@ -0,0 +1,103 @@
+package ingest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+// webhookStore records ApplyWebhook calls, other IssueStore methods are unused.
+type webhookStore struct {
+	IssueStore
+	seen    map[string]bool
+	applied []search.IssueRow
+	deleted []bool
+}
+
+func (ws *webhookStore) ApplyWebhook(_ context.Context, d Delivery, iss search.IssueRow, deleted bool) (bool, error) {
+	if ws.seen[d.ID] {
+		return false, nil
+	}
+	ws.seen[d.ID] = true
+	ws.applied = append(ws.applied, iss)
+	ws.deleted = append(ws.deleted, deleted)
+	return true, nil
+}
+
+const closedEvent = `{
+	"action": "closed",
+	"issue": {"id": 101, "number": 1, "title": "App crashes on login", "body": "500", "state": "closed",
+		"labels": [{"name": "bug"}], "created_at": "2024-11-01T10:15:00Z", "updated_at": "2024-11-04T10:15:00Z"},
+	"repository": {"full_name": "demo/reporadar"}
+}`
+
+func TestVerifyGithubSignature(t *testing.T) {
+	payload := []byte(closedEvent)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(payload)
+	valid := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !VerifyGithubSignature("s3cret", payload, valid) {
+		t.Error("expected valid signature to verify")
+	}
+	if VerifyGithubSignature("other", payload, valid) {
+		t.Error("expected signature with a different secret to fail")
+	}
+	if VerifyGithubSignature("s3cret", append(payload, ' '), valid) {
+		t.Error("expected signature of a modified payload to fail")
+	}
+	if VerifyGithubSignature("", payload, "sha256=") {
+		t.Error("expected empty secret to fail")
+	}
+}
+
+func TestHandleGithubIssueEvent_IsIdempotentPerDelivery(t *testing.T) {
+	store := &webhookStore{seen: map[string]bool{}}
+	srv := New(store, nil, Options{})
+
+	for i, want := range []bool{true, false} {
+		applied, err := srv.HandleGithubIssueEvent(context.Background(), "delivery-1", []byte(closedEvent))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if applied != want {
+			t.Errorf("delivery %d: expected applied=%v, got %v", i, want, applied)
+		}
+	}
+
+	if len(store.applied) != 1 {
+		t.Fatalf("expected the issue to be applied once, got %d", len(store.applied))
+	}
+	if got := store.applied[0]; got.ID != "101" || got.State != "closed" || got.Repo != "demo/reporadar" {
+		t.Errorf("unexpected issue %+v", got)
+	}
+}
+
+func TestHandleGithubIssueEvent_DeletedIsTombstoned(t *testing.T) {
+	store := &webhookStore{seen: map[string]bool{}}
+	srv := New(store, nil, Options{})
+
+	payload := []byte(`{"action": "deleted", "issue": {"id": 101, "number": 1, "title": "x"},
+		"repository": {"full_name": "demo/reporadar"}}`)
+	if _, err := srv.HandleGithubIssueEvent(context.Background(), "delivery-2", payload); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.deleted) != 1 || !store.deleted[0] {
+		t.Errorf("expected a tombstone, got %v", store.deleted)
+	}
+}
+
+func TestHandleGithubIssueEvent_IgnoresOtherActions(t *testing.T) {
+	store := &webhookStore{seen: map[string]bool{}}
+	srv := New(store, nil, Options{})
+
+	payload := []byte(`{"action": "pinned", "issue": {"id": 101}, "repository": {"full_name": "demo/reporadar"}}`)
+	applied, err := srv.HandleGithubIssueEvent(context.Background(), "delivery-3", payload)
+	if err != nil || applied || len(store.applied) != 0 {
+		t.Errorf("expected pinned to be ignored, got applied=%v err=%v", applied, err)
+	}
+}
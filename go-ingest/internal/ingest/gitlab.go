@@ -0,0 +1,237 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+// gitlabIDPrefix keeps the ids of GitLab issues and notes apart from those of other sources.
+const gitlabIDPrefix = "gitlab:"
+
+// GitlabSource reads issues from the REST API of gitlab.com or a self-hosted GitLab. Repos are named by the project's
+// path (group/subgroup/project) or numeric ID.
+type GitlabSource struct {
+	// BaseURL is the GitLab instance, e.g. https://gitlab.example.com, without /api/v4.
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func NewGitlabSource(baseURL, token string) *GitlabSource {
+	return &GitlabSource{
+		BaseURL: baseURL,
+		Token:   token,
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+type gitlabUser struct {
+	Username string `json:"username"`
+}
+
+type gitlabIssue struct {
+	ID          int64        `json:"id"`
+	IID         int          `json:"iid"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Labels      []string     `json:"labels"`
+	State       string       `json:"state"`
+	Author      gitlabUser   `json:"author"`
+	Assignees   []gitlabUser `json:"assignees"`
+	Milestone   *struct {
+		Title string `json:"title"`
+	} `json:"milestone"`
+	UserNotesCount int        `json:"user_notes_count"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	ClosedAt       *time.Time `json:"closed_at"`
+	Links          struct {
+		// ClosedAsDuplicateOf is the URL of the issue a duplicate was closed in favour of.
+		ClosedAsDuplicateOf string `json:"closed_as_duplicate_of"`
+	} `json:"_links"`
+}
+
+type gitlabNote struct {
+	ID        int64      `json:"id"`
+	Body      string     `json:"body"`
+	Author    gitlabUser `json:"author"`
+	System    bool       `json:"system"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// FetchIssues pages through GET /projects/{id}/issues, oldest change first. Issues updated before the state
+// watermark are filtered upstream with `updated_after`. The notes of fetched issues that have any are fetched from GET
+// /projects/{id}/issues/{iid}/notes, newest change first down to the watermark, leaving out system notes such as
+// label changes.
+func (g *GitlabSource) FetchIssues(ctx context.Context, repo string, state SyncState) (FetchResult, error) {
+	q := url.Values{}
+	q.Set("scope", "all")
+	q.Set("per_page", "100")
+	q.Set("order_by", "updated_at")
+	q.Set("sort", "asc")
+	if !state.LastUpdatedAt.IsZero() {
+		q.Set("updated_after", state.LastUpdatedAt.UTC().Format(time.RFC3339))
+	}
+	next := fmt.Sprintf("%s/api/v4/projects/%s/issues?%s", g.BaseURL, url.PathEscape(repo), q.Encode())
+
+	var (
+		res    FetchResult
+		issues []gitlabIssue
+	)
+	for page := 1; next != ""; page++ {
+		var items []gitlabIssue
+		resp, err := g.get(ctx, next, &items)
+		if err != nil {
+			return res, fmt.Errorf("gitlab page %d: %w", page, err)
+		}
+		for _, gi := range items {
+			res.Issues = append(res.Issues, gi.toRow(repo))
+		}
+		issues = append(issues, items...)
+		log.Printf("[gitlab] repo=%s page=%d items=%d", repo, page, len(items))
+		next = gitlabNextPage(resp)
+	}
+
+	for _, gi := range issues {
+		if gi.UserNotesCount == 0 {
+			continue
+		}
+		notes, err := g.fetchNotes(ctx, repo, gi, state.LastUpdatedAt)
+		if err != nil {
+			return res, err
+		}
+		res.Comments = append(res.Comments, notes...)
+	}
+	return res, nil
+}
+
+// fetchNotes returns the notes of the issue changed since the watermark, oldest first.
+func (g *GitlabSource) fetchNotes(ctx context.Context, repo string, gi gitlabIssue, since time.Time) ([]Comment, error) {
+	next := fmt.Sprintf("%s/api/v4/projects/%s/issues/%d/notes?per_page=100&sort=desc&order_by=updated_at",
+		g.BaseURL, url.PathEscape(repo), gi.IID)
+	var (
+		out  []Comment
+		seen bool
+	)
+	for page := 1; next != "" && !seen; page++ {
+		var notes []gitlabNote
+		resp, err := g.get(ctx, next, &notes)
+		if err != nil {
+			return out, fmt.Errorf("gitlab notes of #%d page %d: %w", gi.IID, page, err)
+		}
+		for _, n := range notes {
+			if !n.UpdatedAt.After(since) {
+				// The rest was stored by an earlier sync.
+				seen = true
+				break
+			}
+			if n.System {
+				continue
+			}
+			out = append(out, Comment{
+				ID:        gitlabIDPrefix + "note:" + strconv.FormatInt(n.ID, 10),
+				Repo:      repo,
+				IssueID:   gitlabIDPrefix + strconv.FormatInt(gi.ID, 10),
+				Author:    n.Author.Username,
+				Body:      n.Body,
+				CreatedAt: n.CreatedAt,
+				UpdatedAt: n.UpdatedAt,
+			})
+		}
+		next = gitlabNextPage(resp)
+	}
+	slices.Reverse(out)
+	return out, nil
+}
+
+// gitlabNextPage returns the URL of the next page from the `Link` header, or from `X-Next-Page` when a proxy
+// stripped the former; "" on the last page.
+func gitlabNextPage(resp *http.Response) string {
+	if next := nextPage(resp); next != "" {
+		return next
+	}
+	if p := resp.Header.Get("X-Next-Page"); p != "" && resp.Request != nil {
+		u := *resp.Request.URL
+		q := u.Query()
+		q.Set("page", p)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return ""
+}
+
+func (g *GitlabSource) get(ctx context.Context, url string, target any) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if g.Token != "" {
+		req.Header.Set("PRIVATE-TOKEN", g.Token)
+	}
+
+	resp, err := g.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return resp, nil
+}
+
+// toRow maps the issue, GitLab's "opened" state becomes "open". GitLab only records that an issue was closed as a
+// duplicate; for other closed issues the reason is left empty rather than counting them as completed.
+func (gi gitlabIssue) toRow(repo string) search.IssueRow {
+	var assignees []string
+	for _, a := range gi.Assignees {
+		assignees = append(assignees, a.Username)
+	}
+	labels := gi.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+	iss := search.IssueRow{
+		ID:        gitlabIDPrefix + strconv.FormatInt(gi.ID, 10),
+		Repo:      repo,
+		Number:    gi.IID,
+		Title:     gi.Title,
+		Body:      gi.Description,
+		Labels:    labels,
+		State:     gi.State,
+		Author:    gi.Author.Username,
+		Assignees: assignees,
+		CreatedAt: gi.CreatedAt,
+		UpdatedAt: gi.UpdatedAt,
+	}
+	if gi.State == "opened" {
+		iss.State = "open"
+	}
+	if gi.Milestone != nil {
+		iss.Milestone = gi.Milestone.Title
+	}
+	if gi.State == "closed" {
+		iss.ClosedAt = gi.ClosedAt
+		if gi.Links.ClosedAsDuplicateOf != "" {
+			iss.CloseReason = search.CloseReasonDuplicate
+		}
+	}
+	return iss
+}
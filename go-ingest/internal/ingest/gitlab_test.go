@@ -0,0 +1,141 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGitlabSource_FetchIssuesPaginatesAndMapsNotes(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("PRIVATE-TOKEN"); got != "secret" {
+			t.Errorf("expected private token, got %q", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/group%2Fsub%2Fapp/issues":
+			if r.URL.Query().Get("page") == "" {
+				if r.URL.Query().Get("scope") != "all" || r.URL.Query().Get("updated_after") != "" {
+					t.Errorf("unexpected query %q", r.URL.RawQuery)
+				}
+				w.Header().Set("Link", fmt.Sprintf(`<%s/api/v4/projects/group%%2Fsub%%2Fapp/issues?page=2>; rel="next"`, srv.URL))
+				fmt.Fprint(w, `[{"id": 501, "iid": 1, "title": "App crashes on login", "description": "500 on SSO login",
+					"labels": ["bug"], "state": "opened", "author": {"username": "alice"}, "assignees": [{"username": "bob"}],
+					"milestone": {"title": "16.0"}, "user_notes_count": 1,
+					"created_at": "2024-11-01T10:15:00Z", "updated_at": "2024-11-02T10:15:00Z"}]`)
+				return
+			}
+			fmt.Fprint(w, `[{"id": 502, "iid": 2, "title": "Dark mode", "description": null, "labels": [], "state": "closed",
+				"author": {"username": "carol"}, "created_at": "2024-11-03T09:00:00Z", "updated_at": "2024-11-04T09:00:00Z",
+				"closed_at": "2024-11-04T09:00:00Z"},
+				{"id": 503, "iid": 3, "title": "Dark theme", "labels": [], "state": "closed",
+				"created_at": "2024-11-03T09:00:00Z", "updated_at": "2024-11-04T09:00:00Z", "closed_at": "2024-11-04T09:00:00Z",
+				"_links": {"closed_as_duplicate_of": "https://gitlab.example.com/api/v4/projects/7/issues/2"}}]`)
+		case "/api/v4/projects/group%2Fsub%2Fapp/issues/1/notes":
+			fmt.Fprint(w, `[
+				{"id": 9002, "body": "Same here on Firefox", "system": false, "author": {"username": "dave"},
+				 "created_at": "2024-11-02T10:15:00Z", "updated_at": "2024-11-02T10:15:00Z"},
+				{"id": 9001, "body": "added ~bug label", "system": true, "author": {"username": "alice"},
+				 "created_at": "2024-11-01T10:16:00Z", "updated_at": "2024-11-01T10:16:00Z"}
+			]`)
+		default:
+			// Issue 2 has no notes to fetch.
+			t.Errorf("unexpected path %q", r.URL.EscapedPath())
+		}
+	}))
+	defer srv.Close()
+
+	res, err := NewGitlabSource(srv.URL, "secret").FetchIssues(context.Background(), "group/sub/app", SyncState{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := res.Issues
+	if len(got) != 3 {
+		t.Fatalf("expected 3 issues, got %d", len(got))
+	}
+	first := got[0]
+	if first.ID != "gitlab:501" || first.Number != 1 || first.Repo != "group/sub/app" || first.State != "open" ||
+		first.Author != "alice" || first.Milestone != "16.0" || len(first.Assignees) != 1 || first.Assignees[0] != "bob" {
+		t.Errorf("unexpected first issue: %+v", first)
+	}
+	if len(first.Labels) != 1 || first.Labels[0] != "bug" {
+		t.Errorf("expected labels [bug], got %v", first.Labels)
+	}
+	// GitLab does not say why the second issue was closed, only that the third is a duplicate.
+	if second := got[1]; second.State != "closed" || second.ClosedAt == nil || second.CloseReason != "" {
+		t.Errorf("unexpected second issue: %+v", second)
+	}
+	if third := got[2]; third.State != "closed" || third.CloseReason != "duplicate" {
+		t.Errorf("unexpected third issue: %+v", third)
+	}
+
+	// System notes are left out.
+	if len(res.Comments) != 1 {
+		t.Fatalf("expected one note, got %+v", res.Comments)
+	}
+	if c := res.Comments[0]; c.ID != "gitlab:note:9002" || c.IssueID != "gitlab:501" || c.Author != "dave" {
+		t.Errorf("unexpected note: %+v", c)
+	}
+}
+
+func TestGitlabSource_FetchIssuesIncremental(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/projects/42/issues":
+		case "/api/v4/projects/42/issues/1/notes":
+			// Newest change first, the second note predates the watermark so the next page is not needed.
+			w.Header().Set("Link", fmt.Sprintf(`<%s/api/v4/projects/42/issues/1/notes?page=2>; rel="next"`, srv.URL))
+			fmt.Fprint(w, `[
+				{"id": 9003, "body": "Still broken", "author": {"username": "dave"},
+				 "created_at": "2024-11-05T08:00:00Z", "updated_at": "2024-11-05T08:00:00Z"},
+				{"id": 9002, "body": "Same here", "author": {"username": "carol"},
+				 "created_at": "2024-11-01T10:15:00Z", "updated_at": "2024-11-01T10:15:00Z"}
+			]`)
+			return
+		default:
+			t.Errorf("unexpected request %q", r.URL.String())
+			return
+		}
+		if got := r.URL.Query().Get("updated_after"); got != "2024-11-02T10:15:00Z" {
+			t.Errorf("expected updated_after watermark, got %q", got)
+		}
+		id := 502
+		if r.URL.Query().Get("page") == "" {
+			// Offset pagination headers only
+			w.Header().Set("X-Next-Page", "2")
+			id = 501
+		}
+		fmt.Fprintf(w, `[{"id": %d, "iid": %d, "title": "Crash", "state": "opened", "user_notes_count": %d,
+			"created_at": "2024-11-01T10:15:00Z", "updated_at": "2024-11-05T08:00:00Z"}]`, id, id-500, 502-id)
+	}))
+	defer srv.Close()
+
+	since := time.Date(2024, 11, 2, 10, 15, 0, 0, time.UTC)
+	res, err := NewGitlabSource(srv.URL, "").FetchIssues(context.Background(), "42", SyncState{LastUpdatedAt: since})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Issues) != 2 || res.Issues[0].ID != "gitlab:501" || res.Issues[1].ID != "gitlab:502" {
+		t.Errorf("expected both pages, got %+v", res.Issues)
+	}
+	if len(res.Comments) != 1 || res.Comments[0].ID != "gitlab:note:9003" {
+		t.Errorf("expected only the note changed since the watermark, got %+v", res.Comments)
+	}
+}
+
+func TestGitlabSource_FetchIssuesFailsOnErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"401 Unauthorized"}`, http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	_, err := NewGitlabSource(srv.URL, "wrong").FetchIssues(context.Background(), "group/app", SyncState{})
+	if err == nil {
+		t.Fatal("expected an error for 401 response")
+	}
+}
@@ -0,0 +1,268 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/textnorm"
+)
+
+// jiraIDPrefix keeps the ids of Jira issues apart from those of other sources.
+const jiraIDPrefix = "jira:"
+
+const (
+	jiraPageSize = 100
+	jiraFields   = "summary,description,labels,status,created,updated,reporter,assignee,resolution,resolutiondate,fixVersions"
+	// jiraTimeLayout is how Jira's REST API formats timestamps, e.g. 2024-11-01T10:15:00.000+0000.
+	jiraTimeLayout = "2006-01-02T15:04:05.000-0700"
+	// jiraJQLTimeLayout is the minute precision JQL compares dates with.
+	jiraJQLTimeLayout = "2006-01-02 15:04"
+)
+
+// JiraSource reads issues from the REST API (v2, whose descriptions are wiki markup) of Jira Data Center or, with
+// Cloud set, of Jira Cloud. Repos are named by the project key, e.g. PROJ.
+type JiraSource struct {
+	// BaseURL is the Jira instance, e.g. https://example.atlassian.net, without /rest/api/2.
+	BaseURL string
+	// Cloud pages through the enhanced JQL search of Jira Cloud, which replaced the offset paginated one there.
+	Cloud bool
+	// User is the account (email on Jira Cloud) Token is an API token of; with no User, Token is sent as a bearer
+	// personal access token.
+	User       string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func NewJiraSource(baseURL, user, token string) *JiraSource {
+	return &JiraSource{
+		BaseURL: baseURL,
+		User:    user,
+		Token:   token,
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+type jiraTime struct{ time.Time }
+
+func (t *jiraTime) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if s == "" {
+		return nil
+	}
+	parsed, err := time.Parse(jiraTimeLayout, s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+type jiraUser struct {
+	// Name is the username on Jira Data Center; Jira Cloud only returns the display name.
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+func (u *jiraUser) login() string {
+	if u == nil {
+		return ""
+	}
+	if u.Name != "" {
+		return u.Name
+	}
+	return u.DisplayName
+}
+
+type jiraIssue struct {
+	ID     string `json:"id"`
+	Key    string `json:"key"`
+	Fields struct {
+		Summary     string   `json:"summary"`
+		Description string   `json:"description"`
+		Labels      []string `json:"labels"`
+		Status      struct {
+			StatusCategory struct {
+				Key string `json:"key"`
+			} `json:"statusCategory"`
+		} `json:"status"`
+		Reporter   *jiraUser `json:"reporter"`
+		Assignee   *jiraUser `json:"assignee"`
+		Resolution *struct {
+			Name string `json:"name"`
+		} `json:"resolution"`
+		ResolutionDate *jiraTime `json:"resolutiondate"`
+		FixVersions    []struct {
+			Name string `json:"name"`
+		} `json:"fixVersions"`
+		Created jiraTime `json:"created"`
+		Updated jiraTime `json:"updated"`
+	} `json:"fields"`
+}
+
+type jiraSearchPage struct {
+	Issues []jiraIssue `json:"issues"`
+	// Total is set by the offset paginated search of Jira Data Center.
+	Total int `json:"total"`
+	// NextPageToken and IsLast are set by the enhanced search of Jira Cloud.
+	NextPageToken string `json:"nextPageToken"`
+	IsLast        bool   `json:"isLast"`
+}
+
+// FetchIssues pages through a JQL search for the project's issues, oldest change first: GET /rest/api/2/search by
+// startAt on Jira Data Center, GET /rest/api/2/search/jql by nextPageToken on Jira Cloud. JQL compares dates by the
+// minute in the timezone of the Jira user, so issues updated up to a day before the state watermark are fetched
+// again; unchanged ones are skipped on upsert.
+func (j *JiraSource) FetchIssues(ctx context.Context, repo string, state SyncState) (FetchResult, error) {
+	var res FetchResult
+	if j.BaseURL == "" {
+		return res, errors.New("jira url is not configured")
+	}
+	jql := fmt.Sprintf("project = %s", strconv.Quote(repo))
+	if !state.LastUpdatedAt.IsZero() {
+		since := state.LastUpdatedAt.UTC().Add(-24 * time.Hour)
+		jql += fmt.Sprintf(" AND updated >= %q", since.Format(jiraJQLTimeLayout))
+	}
+	jql += " ORDER BY updated ASC"
+
+	endpoint := j.BaseURL + "/rest/api/2/search"
+	if j.Cloud {
+		endpoint += "/jql"
+	}
+	var (
+		startAt   int
+		pageToken string
+	)
+	for page := 1; ; page++ {
+		q := url.Values{}
+		q.Set("jql", jql)
+		q.Set("maxResults", strconv.Itoa(jiraPageSize))
+		q.Set("fields", jiraFields)
+		switch {
+		case !j.Cloud:
+			q.Set("startAt", strconv.Itoa(startAt))
+		case pageToken != "":
+			q.Set("nextPageToken", pageToken)
+		}
+		var sp jiraSearchPage
+		if err := j.get(ctx, endpoint+"?"+q.Encode(), &sp); err != nil {
+			return res, fmt.Errorf("jira page %d: %w", page, err)
+		}
+		for _, ji := range sp.Issues {
+			res.Issues = append(res.Issues, ji.toRow(repo))
+		}
+		log.Printf("[jira] repo=%s page=%d items=%d", repo, page, len(sp.Issues))
+
+		if j.Cloud {
+			if sp.IsLast || sp.NextPageToken == "" {
+				return res, nil
+			}
+			pageToken = sp.NextPageToken
+			continue
+		}
+		// The server may cap maxResults below what was asked for, so move on by what it returned.
+		startAt += len(sp.Issues)
+		if len(sp.Issues) == 0 || startAt >= sp.Total {
+			return res, nil
+		}
+	}
+}
+
+func (j *JiraSource) get(ctx context.Context, url string, target any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	switch {
+	case j.User != "":
+		req.SetBasicAuth(j.User, j.Token)
+	case j.Token != "":
+		req.Header.Set("Authorization", "Bearer "+j.Token)
+	}
+
+	resp, err := j.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// jiraCloseReason maps a resolution onto a close reason. Resolutions are configurable per instance, unknown ones
+// count as completed.
+func jiraCloseReason(resolution string) string {
+	switch strings.ToLower(resolution) {
+	case "duplicate":
+		return search.CloseReasonDuplicate
+	case "won't fix", "won't do", "cannot reproduce", "incomplete", "declined", "obsolete":
+		return search.CloseReasonNotPlanned
+	default:
+		return search.CloseReasonCompleted
+	}
+}
+
+// toRow maps the issue. Issues whose status is in the "done" category are closed; the description is kept in wiki
+// markup, and the number is that of the key (PROJ-123).
+func (ji jiraIssue) toRow(repo string) search.IssueRow {
+	f := ji.Fields
+	labels := f.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+	var assignees []string
+	if a := f.Assignee.login(); a != "" {
+		assignees = []string{a}
+	}
+	iss := search.IssueRow{
+		ID:         jiraIDPrefix + ji.ID,
+		Repo:       repo,
+		Title:      f.Summary,
+		Body:       f.Description,
+		BodyFormat: textnorm.FormatJiraWiki,
+		Labels:     labels,
+		State:      "open",
+		Author:     f.Reporter.login(),
+		Assignees:  assignees,
+		CreatedAt:  f.Created.Time,
+		UpdatedAt:  f.Updated.Time,
+	}
+	if i := strings.LastIndex(ji.Key, "-"); i >= 0 {
+		iss.Number, _ = strconv.Atoi(ji.Key[i+1:])
+	}
+	if len(f.FixVersions) > 0 {
+		iss.Milestone = f.FixVersions[0].Name
+	}
+	if f.Status.StatusCategory.Key == "done" {
+		iss.State = "closed"
+		iss.CloseReason = search.CloseReasonCompleted
+		if f.Resolution != nil {
+			iss.CloseReason = jiraCloseReason(f.Resolution.Name)
+		}
+		if f.ResolutionDate != nil && !f.ResolutionDate.IsZero() {
+			closedAt := f.ResolutionDate.Time
+			iss.ClosedAt = &closedAt
+		}
+	}
+	return iss
+}
@@ -0,0 +1,150 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/textnorm"
+)
+
+func TestJiraSource_FetchIssuesPaginatesAndMaps(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "bot@example.com" || pass != "secret" {
+			t.Errorf("expected basic auth, got %q", r.Header.Get("Authorization"))
+		}
+		if r.URL.Path != "/rest/api/2/search" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if got := q.Get("jql"); got != `project = "PROJ" ORDER BY updated ASC` {
+			t.Errorf("unexpected jql %q", got)
+		}
+		if !strings.Contains(q.Get("fields"), "description") {
+			t.Errorf("expected description among fields, got %q", q.Get("fields"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch q.Get("startAt") {
+		case "0":
+			fmt.Fprint(w, `{"startAt": 0, "maxResults": 1, "total": 2, "issues": [{"id": "10001", "key": "PROJ-7", "fields": {
+				"summary": "App crashes on login", "description": "h2. Steps\n* open *login*\n* see [logs|https://example.com/l]",
+				"labels": ["bug"], "status": {"name": "In Progress", "statusCategory": {"key": "indeterminate"}},
+				"reporter": {"name": "alice", "displayName": "Alice"}, "assignee": {"displayName": "Bob"},
+				"fixVersions": [{"name": "2.1"}], "resolution": null, "resolutiondate": null,
+				"created": "2024-11-01T10:15:00.000+0000", "updated": "2024-11-02T12:15:00.000+0200"}}]}`)
+		case "1":
+			fmt.Fprint(w, `{"startAt": 1, "maxResults": 1, "total": 2, "issues": [{"id": "10002", "key": "PROJ-8", "fields": {
+				"summary": "Login crash again", "description": null, "labels": [],
+				"status": {"name": "Closed", "statusCategory": {"key": "done"}}, "resolution": {"name": "Duplicate"},
+				"resolutiondate": "2024-11-04T09:00:00.000+0000",
+				"created": "2024-11-03T09:00:00.000+0000", "updated": "2024-11-04T09:00:00.000+0000"}}]}`)
+		default:
+			t.Errorf("unexpected startAt %q", q.Get("startAt"))
+		}
+	}))
+	defer srv.Close()
+
+	res, err := NewJiraSource(srv.URL, "bot@example.com", "secret").FetchIssues(context.Background(), "PROJ", SyncState{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := res.Issues
+	if len(got) != 2 {
+		t.Fatalf("expected 2 issues, got %d", len(got))
+	}
+	first := got[0]
+	if first.ID != "jira:10001" || first.Number != 7 || first.Repo != "PROJ" || first.State != "open" ||
+		first.Author != "alice" || first.Milestone != "2.1" || len(first.Assignees) != 1 || first.Assignees[0] != "Bob" {
+		t.Errorf("unexpected first issue: %+v", first)
+	}
+	// The markup is converted by the indexer, the stored body is the description as written.
+	if want := "h2. Steps\n* open *login*\n* see [logs|https://example.com/l]"; first.Body != want || first.BodyFormat != textnorm.FormatJiraWiki {
+		t.Errorf("expected the description %q in Jira markup, got %q (%q)", want, first.Body, first.BodyFormat)
+	}
+	if len(first.Labels) != 1 || first.Labels[0] != "bug" {
+		t.Errorf("expected labels [bug], got %v", first.Labels)
+	}
+	if want := time.Date(2024, 11, 2, 10, 15, 0, 0, time.UTC); !first.UpdatedAt.Equal(want) {
+		t.Errorf("expected updated %v, got %v", want, first.UpdatedAt)
+	}
+	second := got[1]
+	if second.State != "closed" || second.CloseReason != "duplicate" || second.ClosedAt == nil || second.Body != "" {
+		t.Errorf("unexpected second issue: %+v", second)
+	}
+}
+
+func TestJiraSource_FetchIssuesCloudPagesByToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/search/jql" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Has("startAt") {
+			t.Errorf("unexpected startAt in %q", r.URL.RawQuery)
+		}
+		switch q.Get("nextPageToken") {
+		case "":
+			fmt.Fprint(w, `{"issues": [{"id": "10001", "key": "PROJ-1", "fields": {"summary": "Crash",
+				"status": {"statusCategory": {"key": "new"}},
+				"created": "2024-11-01T10:15:00.000+0000", "updated": "2024-11-01T10:15:00.000+0000"}}],
+				"nextPageToken": "page-2", "isLast": false}`)
+		case "page-2":
+			fmt.Fprint(w, `{"issues": [{"id": "10002", "key": "PROJ-2", "fields": {"summary": "Hang",
+				"status": {"statusCategory": {"key": "new"}},
+				"created": "2024-11-02T10:15:00.000+0000", "updated": "2024-11-02T10:15:00.000+0000"}}], "isLast": true}`)
+		default:
+			t.Errorf("unexpected nextPageToken %q", q.Get("nextPageToken"))
+		}
+	}))
+	defer srv.Close()
+
+	src := NewJiraSource(srv.URL, "bot@example.com", "secret")
+	src.Cloud = true
+	res, err := src.FetchIssues(context.Background(), "PROJ", SyncState{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Issues) != 2 || res.Issues[0].ID != "jira:10001" || res.Issues[1].ID != "jira:10002" {
+		t.Errorf("expected both pages, got %+v", res.Issues)
+	}
+}
+
+func TestJiraSource_FetchIssuesIncremental(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer pat" {
+			t.Errorf("expected bearer token, got %q", got)
+		}
+		// A day of overlap absorbs the timezone JQL dates are read in.
+		want := `project = "PROJ" AND updated >= "2024-11-01 10:15" ORDER BY updated ASC`
+		if got := r.URL.Query().Get("jql"); got != want {
+			t.Errorf("expected jql %q, got %q", want, got)
+		}
+		fmt.Fprint(w, `{"startAt": 0, "maxResults": 100, "total": 0, "issues": []}`)
+	}))
+	defer srv.Close()
+
+	since := time.Date(2024, 11, 2, 10, 15, 0, 0, time.UTC)
+	res, err := NewJiraSource(srv.URL, "", "pat").FetchIssues(context.Background(), "PROJ", SyncState{LastUpdatedAt: since})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Issues) != 0 {
+		t.Errorf("expected no issues, got %+v", res.Issues)
+	}
+}
+
+func TestJiraSource_FetchIssuesFailsOnErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errorMessages":["The value 'NOPE' does not exist for the field 'project'."]}`, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	_, err := NewJiraSource(srv.URL, "", "").FetchIssues(context.Background(), "NOPE", SyncState{})
+	if err == nil {
+		t.Fatal("expected an error for 400 response")
+	}
+}
@@ -0,0 +1,26 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/jobs"
+)
+
+const JobKind = "ingest"
+
+type JobParams struct {
+	Mode string `json:"mode"`
+	Full bool   `json:"full"`
+}
+
+// RunJob runs an ingest job, see jobs.Handler.
+func (s *Service) RunJob(ctx context.Context, job jobs.Job, report jobs.ReportFunc) (any, error) {
+	var params JobParams
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		return nil, fmt.Errorf("invalid job params: %w", err)
+	}
+	stats, err := s.Ingest(ctx, job.Repo, params.Mode, params.Full, func(st Stats) { report(st) })
+	return stats, err
+}
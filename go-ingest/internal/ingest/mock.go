@@ -0,0 +1,61 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+// MockSource serves issues from a local JSON file, see data/mock_issues.json.
+type MockSource struct {
+	Path string
+}
+
+// mockIssue is an issue of the mock file with its comments.
+type mockIssue struct {
+	search.IssueRow
+	Comments []Comment `json:"comments"`
+}
+
+func NewMockSource(path string) *MockSource {
+	return &MockSource{Path: path}
+}
+
+// FetchIssues returns the issues of the file that belong to repo and were updated since the state watermark, and
+// their comments updated since then. Issues without a repo are assigned to it.
+func (m *MockSource) FetchIssues(_ context.Context, repo string, state SyncState) (FetchResult, error) {
+	b, err := os.ReadFile(m.Path)
+	if err != nil {
+		return FetchResult{}, fmt.Errorf("mock file not found: %w", err)
+	}
+
+	var issues []mockIssue
+	if err := json.Unmarshal(b, &issues); err != nil {
+		return FetchResult{}, fmt.Errorf("invalid json structure: %w", err)
+	}
+
+	out := FetchResult{Issues: make([]search.IssueRow, 0, len(issues))}
+	for _, iss := range issues {
+		if iss.Repo == "" {
+			iss.Repo = repo
+		}
+		if iss.Repo != repo || iss.UpdatedAt.Before(state.LastUpdatedAt) {
+			continue
+		}
+		out.Issues = append(out.Issues, iss.IssueRow)
+		for _, c := range iss.Comments {
+			if c.UpdatedAt.IsZero() {
+				c.UpdatedAt = c.CreatedAt
+			}
+			if c.UpdatedAt.Before(state.LastUpdatedAt) {
+				continue
+			}
+			c.Repo, c.IssueID = repo, iss.ID
+			out.Comments = append(out.Comments, c)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,92 @@
+package ingest
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PullRequest is a pull (or merge) request of a repository, stored to tell which issues have a fix in flight.
+type PullRequest struct {
+	ID     string `json:"id"`
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	// State is open, closed or merged.
+	State     string     `json:"state"`
+	Author    string     `json:"author"`
+	URL       string     `json:"url"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	MergedAt  *time.Time `json:"merged_at,omitempty"`
+}
+
+// How an issue was linked to a pull request.
+const (
+	// LinkReference is a closing keyword in the pull request, e.g. "fixes #123".
+	LinkReference = "reference"
+	// LinkTimeline is a cross-reference event in the issue's timeline.
+	LinkTimeline = "timeline"
+)
+
+// Link ties an issue to a pull request of the same repo, both by number.
+type Link struct {
+	IssueNumber int
+	PRNumber    int
+	Source      string
+}
+
+// closingRefRe matches a closing keyword and the reference following it.
+var closingRefRe = regexp.MustCompile(`(?i)\b(?:close[sd]?|fix(?:e[sd])?|resolve[sd]?):?\s+(\S+)`)
+
+// ParseClosingRefs returns the numbers of the issues of repo that text says it closes, in order of appearance and
+// without duplicates. References are "#123", "owner/repo#123" or the URL of the issue; references to issues of
+// other repos are ignored.
+func ParseClosingRefs(text, repo string) []int {
+	var out []int
+	seen := map[int]bool{}
+	for _, m := range closingRefRe.FindAllStringSubmatch(text, -1) {
+		n, ok := parseRef(strings.TrimRight(m[1], ".,;:!?)"), repo)
+		if ok && !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// parseRef parses a reference to an issue of repo.
+func parseRef(ref, repo string) (int, bool) {
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		u, err := url.Parse(ref)
+		if err != nil {
+			return 0, false
+		}
+		// https://github.com/owner/repo/issues/123 or https://gitlab.com/group/project/-/issues/123
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) < 4 || parts[len(parts)-2] != "issues" {
+			return 0, false
+		}
+		project := parts[:len(parts)-2]
+		if project[len(project)-1] == "-" {
+			project = project[:len(project)-1]
+		}
+		if !strings.EqualFold(strings.Join(project, "/"), repo) {
+			return 0, false
+		}
+		return parseNumber(parts[len(parts)-1])
+	}
+	project, number, ok := strings.Cut(ref, "#")
+	if !ok || (project != "" && !strings.EqualFold(project, repo)) {
+		return 0, false
+	}
+	return parseNumber(number)
+}
+
+func parseNumber(s string) (int, bool) {
+	n, err := strconv.Atoi(s)
+	return n, err == nil && n > 0
+}
@@ -0,0 +1,25 @@
+package ingest
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseClosingRefs(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want []int
+	}{
+		{"Fixes #12", []int{12}},
+		{"This closes #3, resolves: #4 and fixed #3 again.", []int{3, 4}},
+		{"Closes demo/reporadar#7 but not other/repo#8", []int{7}},
+		{"fix https://github.com/demo/reporadar/issues/9 and https://github.com/other/repo/issues/10", []int{9}},
+		{"Resolves https://gitlab.com/demo/reporadar/-/issues/11.", []int{11}},
+		{"Related to #5, prefixes #6 and see #7", nil},
+		{"Fixes #abc", nil},
+	} {
+		if got := ParseClosingRefs(tc.text, "demo/reporadar"); !slices.Equal(got, tc.want) {
+			t.Errorf("ParseClosingRefs(%q) = %v, want %v", tc.text, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+type PgRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgRepository(db *pgxpool.Pool) *PgRepository {
+	return &PgRepository{db: db}
+}
+
+// querier is implemented by both the pool and a transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// UpsertIssue inserts the issue or updates the stored row when it changed. A changed title or body clears the stored
+// embedding, normalized body and keywords (and past embedding failures) so they get recomputed. Rows are never overwritten with an
+// older version of the issue, nor by an issue of another repo with the same id.
+func (pgr *PgRepository) UpsertIssue(ctx context.Context, iss search.IssueRow) (UpsertResult, error) {
+	return upsertIssue(ctx, pgr.db, iss)
+}
+
+func upsertIssue(ctx context.Context, q querier, iss search.IssueRow) (UpsertResult, error) {
+	const qSQL = `
+		INSERT INTO issues (id, repo, number, title, body, labels, state, author, created_at, updated_at, stack_fingerprint,
+			assignees, milestone, closed_at, close_reason, body_format)
+		VALUES ($1,$2,$3,$4,$5,$6,NULLIF($7, ''),NULLIF($8, ''),$9,$10,NULLIF($11, ''),$12,NULLIF($13, ''),$14,NULLIF($15, ''),
+			NULLIF($16, ''))
+		ON CONFLICT (id) DO UPDATE SET
+			number = EXCLUDED.number,
+			title = EXCLUDED.title,
+			body = EXCLUDED.body,
+			body_format = EXCLUDED.body_format,
+			labels = EXCLUDED.labels,
+			state = EXCLUDED.state,
+			author = EXCLUDED.author,
+			created_at = EXCLUDED.created_at,
+			updated_at = EXCLUDED.updated_at,
+			stack_fingerprint = EXCLUDED.stack_fingerprint,
+			assignees = EXCLUDED.assignees,
+			milestone = EXCLUDED.milestone,
+			closed_at = EXCLUDED.closed_at,
+			close_reason = EXCLUDED.close_reason,
+			embedding = CASE
+				WHEN (issues.title, issues.body) IS DISTINCT FROM (EXCLUDED.title, EXCLUDED.body) THEN NULL
+				ELSE issues.embedding
+			END,
+			embedding_model = CASE
+				WHEN (issues.title, issues.body) IS DISTINCT FROM (EXCLUDED.title, EXCLUDED.body) THEN NULL
+				ELSE issues.embedding_model
+			END,
+			embedding_dim = CASE
+				WHEN (issues.title, issues.body) IS DISTINCT FROM (EXCLUDED.title, EXCLUDED.body) THEN NULL
+				ELSE issues.embedding_dim
+			END,
+			normalized_body = CASE
+				WHEN (issues.title, issues.body) IS DISTINCT FROM (EXCLUDED.title, EXCLUDED.body) THEN NULL
+				ELSE issues.normalized_body
+			END,
+			keywords = CASE
+				WHEN (issues.title, issues.body) IS DISTINCT FROM (EXCLUDED.title, EXCLUDED.body) THEN NULL
+				ELSE issues.keywords
+			END,
+			embed_attempts = CASE
+				WHEN (issues.title, issues.body) IS DISTINCT FROM (EXCLUDED.title, EXCLUDED.body) THEN 0
+				ELSE issues.embed_attempts
+			END,
+			embed_error = CASE
+				WHEN (issues.title, issues.body) IS DISTINCT FROM (EXCLUDED.title, EXCLUDED.body) THEN NULL
+				ELSE issues.embed_error
+			END
+		WHERE issues.repo = EXCLUDED.repo
+			AND issues.updated_at <= EXCLUDED.updated_at
+			AND (issues.title, issues.body, issues.labels, issues.state, issues.updated_at, issues.stack_fingerprint,
+				issues.assignees, issues.milestone, issues.closed_at, issues.close_reason)
+			IS DISTINCT FROM (EXCLUDED.title, EXCLUDED.body, EXCLUDED.labels, EXCLUDED.state, EXCLUDED.updated_at,
+				EXCLUDED.stack_fingerprint, EXCLUDED.assignees, EXCLUDED.milestone, EXCLUDED.closed_at, EXCLUDED.close_reason)
+		RETURNING (xmax = 0) AS inserted
+	`
+	var inserted bool
+	err := q.QueryRow(ctx, qSQL,
+		iss.ID, iss.Repo, iss.Number, iss.Title, iss.Body, iss.Labels, iss.State, iss.Author, iss.CreatedAt, iss.UpdatedAt,
+		iss.Fingerprint, iss.Assignees, iss.Milestone, iss.ClosedAt, iss.CloseReason, iss.BodyFormat,
+	).Scan(&inserted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Unchanged, nil
+	}
+	if err != nil {
+		return Unchanged, err
+	}
+	if inserted {
+		return Inserted, nil
+	}
+	return Updated, nil
+}
+
+// UpsertComment inserts the comment or updates the stored row when it changed, attached to the issue it refers to by
+// ID or, when the ID is empty, by number. Comments of unknown or deleted issues are skipped as unchanged. With reembed,
+// a changed comment queues its issue to be embedded again.
+func (pgr *PgRepository) UpsertComment(ctx context.Context, c Comment, reembed bool) (UpsertResult, error) {
+	const qSQL = `
+		WITH issue AS (
+			SELECT id FROM issues
+			WHERE repo = $2 AND deleted_at IS NULL AND (id = $3 OR ($3 = '' AND number = $4))
+		), upserted AS (
+			INSERT INTO comments (id, issue_id, repo, author, body, created_at, updated_at)
+			SELECT $1, issue.id, $2, NULLIF($5, ''), $6, $7, $8 FROM issue
+			ON CONFLICT (id) DO UPDATE SET
+				author = EXCLUDED.author,
+				body = EXCLUDED.body,
+				updated_at = EXCLUDED.updated_at
+			WHERE comments.updated_at <= EXCLUDED.updated_at
+				AND (comments.body, comments.updated_at) IS DISTINCT FROM (EXCLUDED.body, EXCLUDED.updated_at)
+			RETURNING issue_id, (xmax = 0) AS inserted
+		), reembedded AS (
+			UPDATE issues SET
+				embedding = NULL,
+				embedding_model = NULL,
+				embedding_dim = NULL,
+				embed_attempts = 0,
+				embed_error = NULL
+			WHERE $9 AND id IN (SELECT issue_id FROM upserted)
+		)
+		SELECT inserted FROM upserted
+	`
+	var inserted bool
+	err := pgr.db.QueryRow(ctx, qSQL,
+		c.ID, c.Repo, c.IssueID, c.IssueNumber, c.Author, c.Body, c.CreatedAt, c.UpdatedAt, reembed,
+	).Scan(&inserted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Unchanged, nil
+	}
+	if err != nil {
+		return Unchanged, err
+	}
+	if inserted {
+		return Inserted, nil
+	}
+	return Updated, nil
+}
+
+// UpsertPullRequest stores the pull request and, in the same transaction, replaces its closing reference links. Rows
+// are never overwritten with an older version of the pull request.
+func (pgr *PgRepository) UpsertPullRequest(ctx context.Context, pr PullRequest, refs []int) (UpsertResult, error) {
+	tx, err := pgr.db.Begin(ctx)
+	if err != nil {
+		return Unchanged, err
+	}
+	defer tx.Rollback(ctx)
+
+	var inserted bool
+	err = tx.QueryRow(ctx, `
+		INSERT INTO pull_requests (id, repo, number, title, body, state, author, url, created_at, updated_at, merged_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9, $10, $11)
+		ON CONFLICT (id) DO UPDATE SET
+			number = EXCLUDED.number,
+			title = EXCLUDED.title,
+			body = EXCLUDED.body,
+			state = EXCLUDED.state,
+			author = EXCLUDED.author,
+			url = EXCLUDED.url,
+			updated_at = EXCLUDED.updated_at,
+			merged_at = EXCLUDED.merged_at
+		WHERE pull_requests.updated_at <= EXCLUDED.updated_at
+			AND (pull_requests.title, pull_requests.body, pull_requests.state, pull_requests.updated_at, pull_requests.merged_at)
+			IS DISTINCT FROM (EXCLUDED.title, EXCLUDED.body, EXCLUDED.state, EXCLUDED.updated_at, EXCLUDED.merged_at)
+		RETURNING (xmax = 0) AS inserted
+	`, pr.ID, pr.Repo, pr.Number, pr.Title, pr.Body, pr.State, pr.Author, pr.URL, pr.CreatedAt, pr.UpdatedAt,
+		pr.MergedAt).Scan(&inserted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Unchanged, nil
+	}
+	if err != nil {
+		return Unchanged, err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM issue_pr_links WHERE repo = $1 AND pr_number = $2 AND source = $3`,
+		pr.Repo, pr.Number, LinkReference)
+	if err != nil {
+		return Unchanged, err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO issue_pr_links (repo, issue_number, pr_number, source)
+		SELECT $1, n, $2, $3 FROM unnest($4::int[]) AS n
+		ON CONFLICT (repo, issue_number, pr_number) DO NOTHING
+	`, pr.Repo, pr.Number, LinkReference, refs)
+	if err != nil {
+		return Unchanged, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Unchanged, err
+	}
+	if inserted {
+		return Inserted, nil
+	}
+	return Updated, nil
+}
+
+func (pgr *PgRepository) LinkPullRequests(ctx context.Context, repo string, links []Link) error {
+	issues := make([]int, len(links))
+	prs := make([]int, len(links))
+	sources := make([]string, len(links))
+	for i, l := range links {
+		issues[i], prs[i], sources[i] = l.IssueNumber, l.PRNumber, l.Source
+	}
+	_, err := pgr.db.Exec(ctx, `
+		INSERT INTO issue_pr_links (repo, issue_number, pr_number, source)
+		SELECT $1, l.issue_number, l.pr_number, l.source
+		FROM unnest($2::int[], $3::int[], $4::text[]) AS l(issue_number, pr_number, source)
+		ON CONFLICT (repo, issue_number, pr_number) DO NOTHING
+	`, repo, issues, prs, sources)
+	return err
+}
+
+// ApplyWebhook records the delivery and applies its issue change in one transaction. Deleted issues are kept as
+// tombstones. Issues stored for another repo than iss.Repo are left alone, the signature of a delivery only vouches
+// for its own repo. Returns false without touching the issue when the delivery was processed before.
+func (pgr *PgRepository) ApplyWebhook(ctx context.Context, d Delivery, iss search.IssueRow, deleted bool) (bool, error) {
+	tx, err := pgr.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO webhook_deliveries (delivery_id, repo, event, action) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (delivery_id) DO NOTHING
+	`, d.ID, d.Repo, d.Event, d.Action)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if deleted {
+		_, err = tx.Exec(ctx, `UPDATE issues SET deleted_at = now() WHERE id = $1 AND repo = $2 AND deleted_at IS NULL`,
+			iss.ID, iss.Repo)
+	} else {
+		_, err = upsertIssue(ctx, tx, iss)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+func (pgr *PgRepository) GetSyncState(ctx context.Context, repo, source string) (SyncState, error) {
+	var (
+		state         SyncState
+		lastUpdatedAt *time.Time
+		etag          *string
+	)
+	err := pgr.db.QueryRow(ctx,
+		`SELECT last_updated_at, etag FROM repo_sync_state WHERE repo = $1 AND source = $2`,
+		repo, source,
+	).Scan(&lastUpdatedAt, &etag)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if lastUpdatedAt != nil {
+		state.LastUpdatedAt = *lastUpdatedAt
+	}
+	if etag != nil {
+		state.ETag = *etag
+	}
+	return state, nil
+}
+
+func (pgr *PgRepository) SaveSyncState(ctx context.Context, repo, source string, state SyncState) error {
+	var lastUpdatedAt *time.Time
+	if !state.LastUpdatedAt.IsZero() {
+		lastUpdatedAt = &state.LastUpdatedAt
+	}
+	_, err := pgr.db.Exec(ctx, `
+		INSERT INTO repo_sync_state (repo, source, last_updated_at, etag, synced_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), now())
+		ON CONFLICT (repo, source) DO UPDATE SET
+			last_updated_at = EXCLUDED.last_updated_at,
+			etag = EXCLUDED.etag,
+			synced_at = EXCLUDED.synced_at
+	`, repo, source, lastUpdatedAt, state.ETag)
+	return err
+}
@@ -0,0 +1,172 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+// testRepository returns a repository on a schema of its own, created from sql/init.sql in the database of
+// REPORADAR_TEST_DATABASE_URL. Tests using it are skipped without one.
+func testRepository(t *testing.T) (*PgRepository, *pgxpool.Pool) {
+	t.Helper()
+	db := testDB(t, readSQL(t, "init.sql"))
+	return NewPgRepository(db), db
+}
+
+// testDB connects to a new schema in the database of REPORADAR_TEST_DATABASE_URL, dropped when the test ends, and
+// runs the setup scripts in it.
+func testDB(t *testing.T, setup ...string) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("REPORADAR_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("REPORADAR_TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+
+	name := fmt.Sprintf("test_ingest_%d", time.Now().UnixNano())
+	admin, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(admin.Close)
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+name); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec(context.Background(), "DROP SCHEMA "+name+" CASCADE") })
+
+	cfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatalf("parse url: %v", err)
+	}
+	cfg.ConnConfig.RuntimeParams["search_path"] = name + ",public"
+	db, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(db.Close)
+	for i, script := range setup {
+		if _, err := db.Exec(ctx, script); err != nil {
+			t.Fatalf("setup script %d: %v", i, err)
+		}
+	}
+	return db
+}
+
+// readSQL reads a script of the sql directory with the scripts it includes by `\ir` in place.
+func readSQL(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile("../../../sql/" + name)
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	lines := strings.Split(string(b), "\n")
+	for i, line := range lines {
+		if included, ok := strings.CutPrefix(line, `\ir `); ok {
+			lines[i] = readSQL(t, strings.TrimSpace(included))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// baselineSchema is the schema of the first release, before sql/upgrade.sql existed.
+const baselineSchema = `
+CREATE EXTENSION IF NOT EXISTS vector;
+CREATE TABLE IF NOT EXISTS issues (
+  id TEXT PRIMARY KEY,
+  repo TEXT NOT NULL,
+  title TEXT NOT NULL,
+  body TEXT,
+  labels TEXT[],
+  created_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL,
+  keywords TEXT[],
+  embedding vector(384)
+);
+CREATE INDEX IF NOT EXISTS idx_issues_repo ON issues(repo);
+CREATE INDEX IF NOT EXISTS idx_issues_created ON issues(created_at);
+CREATE INDEX IF NOT EXISTS idx_issues_embedding ON issues USING ivfflat (embedding vector_cosine_ops) WITH (lists = 100);
+CREATE INDEX IF NOT EXISTS idx_issues_repo_embedding ON issues (repo, embedding);
+`
+
+func TestUpgradeFromBaselineSchema(t *testing.T) {
+	vec := "[" + strings.TrimSuffix(strings.Repeat("0.05,", 384), ",") + "]"
+	seed := fmt.Sprintf(`INSERT INTO issues (id, repo, title, body, labels, created_at, updated_at, embedding)
+		VALUES ('101', 'demo/reporadar', 'App crashes on login', '500', '{bug}', now(), now(), '%s')`, vec)
+	upgrade := readSQL(t, "upgrade.sql")
+	// Running the upgrade twice shows it is idempotent.
+	db := testDB(t, baselineSchema, seed, upgrade, upgrade)
+	pgr := NewPgRepository(db)
+	ctx := context.Background()
+
+	// The vector of the baseline has no chunks, vector search could not find it.
+	var pending bool
+	if err := db.QueryRow(ctx, `SELECT embedding IS NULL FROM issues WHERE id = '101'`).Scan(&pending); err != nil {
+		t.Fatalf("read issue: %v", err)
+	}
+	if !pending {
+		t.Error("expected the baseline embedding to be cleared for embedding in chunks")
+	}
+
+	updated := time.Now().Add(time.Hour)
+	res, err := pgr.UpsertIssue(ctx, search.IssueRow{ID: "101", Repo: "demo/reporadar", Number: 1,
+		Title: "App crashes on login", Body: "500 on login", Labels: []string{"bug"}, State: "open",
+		CreatedAt: updated.Add(-2 * time.Hour), UpdatedAt: updated})
+	if err != nil {
+		t.Fatalf("upsert after upgrade: %v", err)
+	}
+	if res != Updated {
+		t.Errorf("expected the baseline row to be updated, got %v", res)
+	}
+	var indexes int
+	err = db.QueryRow(ctx, `SELECT count(*) FROM pg_indexes
+		WHERE indexname IN ('idx_issues_embedding', 'idx_issues_repo_embedding') AND schemaname = current_schema()`).Scan(&indexes)
+	if err != nil {
+		t.Fatalf("list indexes: %v", err)
+	}
+	if indexes != 0 {
+		t.Errorf("expected the baseline vector indexes to be dropped, %d left", indexes)
+	}
+}
+
+func TestPgRepository_ApplyWebhookLeavesIssuesOfOtherReposAlone(t *testing.T) {
+	pgr, db := testRepository(t)
+	ctx := context.Background()
+
+	created := time.Date(2024, 11, 1, 10, 15, 0, 0, time.UTC)
+	owned := search.IssueRow{ID: "101", Repo: "demo/b", Number: 1, Title: "App crashes on login", Labels: []string{},
+		CreatedAt: created, UpdatedAt: created}
+	if _, err := pgr.UpsertIssue(ctx, owned); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+
+	// Deliveries signed for demo/a naming the id of an issue of demo/b.
+	hijack := owned
+	hijack.Repo = "demo/a"
+	hijack.Title = "hijacked"
+	hijack.UpdatedAt = created.Add(time.Hour)
+	if _, err := pgr.ApplyWebhook(ctx, Delivery{ID: "d-1", Repo: "demo/a", Event: "issues", Action: "edited"}, hijack, false); err != nil {
+		t.Fatalf("apply edit: %v", err)
+	}
+	if _, err := pgr.ApplyWebhook(ctx, Delivery{ID: "d-2", Repo: "demo/a", Event: "issues", Action: "deleted"}, hijack, true); err != nil {
+		t.Fatalf("apply delete: %v", err)
+	}
+
+	var (
+		repo, title string
+		deleted     bool
+	)
+	err := db.QueryRow(ctx, `SELECT repo, title, deleted_at IS NOT NULL FROM issues WHERE id = '101'`).Scan(&repo, &title, &deleted)
+	if err != nil {
+		t.Fatalf("read issue: %v", err)
+	}
+	if repo != "demo/b" || title != owned.Title || deleted {
+		t.Errorf("expected the issue of demo/b unchanged, got repo=%s title=%q deleted=%v", repo, title, deleted)
+	}
+}
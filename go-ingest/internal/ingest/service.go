@@ -0,0 +1,239 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/stacktrace"
+)
+
+var ErrUnknownMode = errors.New("unknown ingest mode")
+
+// SyncState is the per repo and source watermark of the previous sync. A zero LastUpdatedAt means a full sync.
+type SyncState struct {
+	LastUpdatedAt time.Time
+	ETag          string
+}
+
+// Comment is a comment on an issue. The issue is given by IssueID, or by IssueNumber within Repo when the source
+// only knows the number.
+type Comment struct {
+	ID          string    `json:"id"`
+	Repo        string    `json:"repo"`
+	IssueID     string    `json:"issue_id"`
+	IssueNumber int       `json:"issue_number,omitempty"`
+	Author      string    `json:"author"`
+	Body        string    `json:"body"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type FetchResult struct {
+	Issues []search.IssueRow
+	// Comments changed since the sync state, of the issues in Issues or of unchanged ones.
+	Comments []Comment
+	// PullRequests changed since the sync state, for sources that have them.
+	PullRequests []PullRequest
+	// Links found besides the closing references of PullRequests, e.g. timeline cross-references.
+	Links []Link
+	// ETag of the upstream response, sent back as `If-None-Match` on the next sync.
+	ETag string
+	// NotModified is set when upstream confirmed nothing changed since the previous sync.
+	NotModified bool
+}
+
+// Source fetches the issues of a repository that changed since the given sync state.
+type Source interface {
+	FetchIssues(ctx context.Context, repo string, state SyncState) (FetchResult, error)
+}
+
+type UpsertResult int
+
+const (
+	Unchanged UpsertResult = iota
+	Inserted
+	Updated
+)
+
+type IssueStore interface {
+	UpsertIssue(ctx context.Context, iss search.IssueRow) (UpsertResult, error)
+	// UpsertComment stores the comment unless its issue is not stored (e.g. a pull request), which is Unchanged.
+	// With reembed, a new or changed comment clears the issue's embedding so it is embedded again with it.
+	UpsertComment(ctx context.Context, c Comment, reembed bool) (UpsertResult, error)
+	// UpsertPullRequest stores the pull request and replaces its LinkReference links by links to the issues refs.
+	UpsertPullRequest(ctx context.Context, pr PullRequest, refs []int) (UpsertResult, error)
+	// LinkPullRequests stores the links of repo that are not stored yet.
+	LinkPullRequests(ctx context.Context, repo string, links []Link) error
+	GetSyncState(ctx context.Context, repo, source string) (SyncState, error)
+	SaveSyncState(ctx context.Context, repo, source string, state SyncState) error
+	ApplyWebhook(ctx context.Context, d Delivery, iss search.IssueRow, deleted bool) (bool, error)
+}
+
+// maxStatsErrors caps the per issue errors kept in Stats.
+const maxStatsErrors = 20
+
+type Stats struct {
+	Fetched     int      `json:"fetched"`
+	Inserted    int      `json:"inserted"`
+	Updated     int      `json:"updated"`
+	Unchanged   int      `json:"unchanged"`
+	Failed      int      `json:"failed"`
+	Comments    int      `json:"comments"`
+	Pulls       int      `json:"pull_requests"`
+	Errors      []string `json:"errors,omitempty"`
+	NotModified bool     `json:"not_modified,omitempty"`
+}
+
+// fail counts a failed item, e.g. "issue 123".
+func (st *Stats) fail(item string, err error) {
+	st.Failed++
+	if len(st.Errors) < maxStatsErrors {
+		st.Errors = append(st.Errors, fmt.Sprintf("%s: %v", item, err))
+	}
+}
+
+type Options struct {
+	// ReembedComments is set when comments are part of issue embeddings, a new or changed comment then has its
+	// issue embedded again.
+	ReembedComments bool
+}
+
+type Service struct {
+	store   IssueStore
+	sources map[string]Source
+	opts    Options
+}
+
+// New creates an ingest service, sources are keyed by the `mode` they are selected with.
+func New(store IssueStore, sources map[string]Source, opts Options) *Service {
+	return &Service{
+		store:   store,
+		sources: sources,
+		opts:    opts,
+	}
+}
+
+// Modes returns the names of the configured sources.
+func (s *Service) Modes() []string {
+	modes := make([]string, 0, len(s.sources))
+	for mode := range s.sources {
+		modes = append(modes, mode)
+	}
+	sort.Strings(modes)
+	return modes
+}
+
+// Ingest syncs the issues of repo from the source selected by mode. Unless full is set, only issues updated since the
+// previous sync are fetched. Issues that fail to store are counted and skipped, progress is called after each issue.
+func (s *Service) Ingest(ctx context.Context, repo, mode string, full bool, progress func(Stats)) (Stats, error) {
+	start := time.Now()
+	var stats Stats
+
+	src, ok := s.sources[mode]
+	if !ok {
+		return stats, fmt.Errorf("%w: %q", ErrUnknownMode, mode)
+	}
+
+	var state SyncState
+	if !full {
+		var err error
+		state, err = s.store.GetSyncState(ctx, repo, mode)
+		if err != nil {
+			return stats, fmt.Errorf("db error: %w", err)
+		}
+	}
+
+	res, err := src.FetchIssues(ctx, repo, state)
+	if err != nil {
+		return stats, fmt.Errorf("fetch failed: %w", err)
+	}
+	stats.Fetched = len(res.Issues)
+	stats.NotModified = res.NotModified
+	progress(stats)
+
+	if res.NotModified {
+		// Saving the unchanged state records when the repo was last synced.
+		if err := s.store.SaveSyncState(ctx, repo, mode, state); err != nil {
+			return stats, fmt.Errorf("db error: %w", err)
+		}
+		log.Printf("[ingest] repo=%s mode=%s since=%v not_modified=true time=%v", repo, mode, state.LastUpdatedAt, time.Since(start))
+		return stats, nil
+	}
+
+	next := SyncState{LastUpdatedAt: state.LastUpdatedAt, ETag: res.ETag}
+	for _, iss := range res.Issues {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		iss.Fingerprint = stacktrace.Fingerprint(iss.Body)
+		upserted, err := s.store.UpsertIssue(ctx, iss)
+		if err != nil {
+			stats.fail("issue "+iss.ID, err)
+			progress(stats)
+			continue
+		}
+		switch upserted {
+		case Inserted:
+			stats.Inserted++
+		case Updated:
+			stats.Updated++
+		default:
+			stats.Unchanged++
+		}
+		if iss.UpdatedAt.After(next.LastUpdatedAt) {
+			next.LastUpdatedAt = iss.UpdatedAt
+		}
+		progress(stats)
+	}
+	// Comments go after the issues, which have to be stored first.
+	for _, c := range res.Comments {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		upserted, err := s.store.UpsertComment(ctx, c, s.opts.ReembedComments)
+		if err != nil {
+			stats.fail("comment "+c.ID, err)
+			continue
+		}
+		if upserted != Unchanged {
+			stats.Comments++
+		}
+	}
+	for _, pr := range res.PullRequests {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		upserted, err := s.store.UpsertPullRequest(ctx, pr, ParseClosingRefs(pr.Title+"\n"+pr.Body, repo))
+		if err != nil {
+			stats.fail(fmt.Sprintf("pull request #%d", pr.Number), err)
+			continue
+		}
+		if upserted != Unchanged {
+			stats.Pulls++
+		}
+	}
+	if len(res.Links) > 0 {
+		if err := s.store.LinkPullRequests(ctx, repo, res.Links); err != nil {
+			stats.fail("links", err)
+		}
+	}
+	progress(stats)
+	if stats.Failed > 0 {
+		// Keep the old watermark so the failed issues are fetched again on the next sync.
+		next = SyncState{LastUpdatedAt: state.LastUpdatedAt}
+	}
+
+	if err := s.store.SaveSyncState(ctx, repo, mode, next); err != nil {
+		return stats, fmt.Errorf("db error: %w", err)
+	}
+
+	log.Printf("[ingest] repo=%s mode=%s since=%v fetched=%d inserted=%d updated=%d comments=%d pull_requests=%d failed=%d not_modified=%v time=%v",
+		repo, mode, state.LastUpdatedAt, stats.Fetched, stats.Inserted, stats.Updated, stats.Comments, stats.Pulls,
+		stats.Failed, stats.NotModified, time.Since(start))
+	return stats, nil
+}
@@ -0,0 +1,128 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+// stubSource returns res (or err) and records the sync state it was asked with.
+type stubSource struct {
+	res   FetchResult
+	err   error
+	asked *SyncState
+}
+
+func (s *stubSource) FetchIssues(_ context.Context, _ string, state SyncState) (FetchResult, error) {
+	s.asked = &state
+	return s.res, s.err
+}
+
+// syncStore keeps the sync state of a single repo and source, upserts fail for the issues in fail.
+type syncStore struct {
+	IssueStore
+	state    SyncState
+	saved    bool
+	upserted []string
+	fail     map[string]bool
+}
+
+func (ss *syncStore) UpsertIssue(_ context.Context, iss search.IssueRow) (UpsertResult, error) {
+	if ss.fail[iss.ID] {
+		return Unchanged, errors.New("db down")
+	}
+	ss.upserted = append(ss.upserted, iss.ID)
+	return Inserted, nil
+}
+
+func (ss *syncStore) GetSyncState(context.Context, string, string) (SyncState, error) {
+	return ss.state, nil
+}
+
+func (ss *syncStore) SaveSyncState(_ context.Context, _, _ string, state SyncState) error {
+	ss.state, ss.saved = state, true
+	return nil
+}
+
+func TestService_IngestAdvancesSyncState(t *testing.T) {
+	t0 := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	t1, t2 := t0.Add(time.Hour), t0.Add(2*time.Hour)
+	prev := SyncState{LastUpdatedAt: t0, ETag: `"v1"`}
+	changed := FetchResult{
+		Issues: []search.IssueRow{{ID: "2", UpdatedAt: t2}, {ID: "1", UpdatedAt: t1}},
+		ETag:   `"v2"`,
+	}
+
+	for _, tc := range []struct {
+		name      string
+		full      bool
+		res       FetchResult
+		fetchErr  error
+		fail      map[string]bool
+		wantAsked SyncState
+		wantState SyncState
+		wantSaved bool
+		wantErr   bool
+	}{
+		{
+			name:      "success moves the watermark to the newest issue and keeps the new etag",
+			res:       changed,
+			wantAsked: prev,
+			wantState: SyncState{LastUpdatedAt: t2, ETag: `"v2"`},
+			wantSaved: true,
+		},
+		{
+			name:      "a failed issue keeps the old watermark and drops the etag",
+			res:       changed,
+			fail:      map[string]bool{"1": true},
+			wantAsked: prev,
+			wantState: SyncState{LastUpdatedAt: t0},
+			wantSaved: true,
+		},
+		{
+			name:      "not modified keeps the watermark and etag",
+			res:       FetchResult{NotModified: true},
+			wantAsked: prev,
+			wantState: prev,
+			wantSaved: true,
+		},
+		{
+			name:      "full sync ignores the stored state",
+			full:      true,
+			res:       changed,
+			wantAsked: SyncState{},
+			wantState: SyncState{LastUpdatedAt: t2, ETag: `"v2"`},
+			wantSaved: true,
+		},
+		{
+			name:      "a failed fetch leaves the state alone",
+			fetchErr:  errors.New("rate limited"),
+			wantAsked: prev,
+			wantState: prev,
+			wantErr:   true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			src := &stubSource{res: tc.res, err: tc.fetchErr}
+			store := &syncStore{state: prev, fail: tc.fail}
+			svc := New(store, map[string]Source{"github": src}, Options{})
+
+			stats, err := svc.Ingest(context.Background(), "demo/reporadar", "github", tc.full, func(Stats) {})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if src.asked == nil || *src.asked != tc.wantAsked {
+				t.Errorf("expected the source to be asked with %+v, got %+v", tc.wantAsked, src.asked)
+			}
+			if store.saved != tc.wantSaved || store.state != tc.wantState {
+				t.Errorf("expected state %+v (saved %v), got %+v (saved %v)", tc.wantState, tc.wantSaved, store.state, store.saved)
+			}
+			if tc.res.NotModified && (!stats.NotModified || len(store.upserted) != 0) {
+				t.Errorf("expected a not modified sync without upserts, got %+v, upserted %v", stats, store.upserted)
+			}
+		})
+	}
+}
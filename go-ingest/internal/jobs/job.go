@@ -0,0 +1,71 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("job not found")
+	ErrFinished = errors.New("job already finished")
+	// ErrClaimLost is returned to a worker whose job was taken over by another one after its heartbeat went stale.
+	ErrClaimLost = errors.New("job claimed by another worker")
+)
+
+type State string
+
+const (
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+type Job struct {
+	ID              int64           `json:"id"`
+	Kind            string          `json:"kind"`
+	Repo            string          `json:"repo"`
+	Params          json.RawMessage `json:"params"`
+	State           State           `json:"state"`
+	Stats           json.RawMessage `json:"stats"`
+	Error           string          `json:"error,omitempty"`
+	CancelRequested bool            `json:"cancel_requested"`
+	CreatedAt       time.Time       `json:"created_at"`
+	StartedAt       *time.Time      `json:"started_at"`
+	FinishedAt      *time.Time      `json:"finished_at"`
+	// ClaimToken identifies the claim of the worker running the job.
+	ClaimToken int64 `json:"-"`
+}
+
+// Duration is the time the job has been running for, or ran for once finished.
+func (j Job) Duration() time.Duration {
+	if j.StartedAt == nil {
+		return 0
+	}
+	if j.FinishedAt == nil {
+		return time.Since(*j.StartedAt)
+	}
+	return j.FinishedAt.Sub(*j.StartedAt)
+}
+
+func (j Job) MarshalJSON() ([]byte, error) {
+	type plain Job
+	return json.Marshal(struct {
+		plain
+		DurationMs int64 `json:"duration_ms"`
+	}{
+		plain:      plain(j),
+		DurationMs: j.Duration().Milliseconds(),
+	})
+}
+
+// ReportFunc records the intermediate stats of a running job, they are persisted on the next heartbeat.
+type ReportFunc func(stats any)
+
+// Handler runs jobs of one kind and returns their final stats. The context is cancelled when the job gets cancelled.
+type Handler interface {
+	RunJob(ctx context.Context, job Job, report ReportFunc) (any, error)
+}
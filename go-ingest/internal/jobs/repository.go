@@ -0,0 +1,135 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PgRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgRepository(db *pgxpool.Pool) *PgRepository {
+	return &PgRepository{db: db}
+}
+
+const jobColumns = `id, kind, repo, params, state, stats, COALESCE(error, ''), cancel_requested, created_at, started_at,
+	finished_at, claim_token`
+
+// Enqueue queues a job, or returns the queued job of the same kind, repo and params.
+func (pgr *PgRepository) Enqueue(ctx context.Context, kind, repo string, params any) (Job, error) {
+	return scanJob(pgr.db.QueryRow(ctx, `
+		INSERT INTO jobs (kind, repo, params) VALUES ($1, $2, $3)
+		ON CONFLICT (kind, repo, params) WHERE state = 'queued' DO UPDATE SET kind = EXCLUDED.kind
+		RETURNING `+jobColumns,
+		kind, repo, params,
+	))
+}
+
+func (pgr *PgRepository) Get(ctx context.Context, id int64) (Job, error) {
+	job, err := scanJob(pgr.db.QueryRow(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return job, ErrNotFound
+	}
+	return job, err
+}
+
+// Cancel cancels a queued job right away. Running jobs are only flagged, the worker running them stops on its next
+// heartbeat.
+func (pgr *PgRepository) Cancel(ctx context.Context, id int64) (Job, error) {
+	job, err := scanJob(pgr.db.QueryRow(ctx, `
+		UPDATE jobs SET
+			cancel_requested = true,
+			state = CASE WHEN state = 'queued' THEN 'cancelled' ELSE state END,
+			finished_at = CASE WHEN state = 'queued' THEN now() ELSE finished_at END
+		WHERE id = $1 AND state IN ('queued', 'running')
+		RETURNING `+jobColumns,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := pgr.Get(ctx, id); err != nil {
+			return job, err
+		}
+		return job, ErrFinished
+	}
+	return job, err
+}
+
+// Claim marks the oldest queued job as running and returns it, or nil when there is none. Running jobs without a
+// heartbeat for staleAfter belonged to a worker that died and are claimed again.
+func (pgr *PgRepository) Claim(ctx context.Context, kinds []string, staleAfter time.Duration) (*Job, error) {
+	job, err := scanJob(pgr.db.QueryRow(ctx, `
+		UPDATE jobs SET state = 'running', started_at = now(), heartbeat_at = now(), claim_token = claim_token + 1
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE kind = ANY($1)
+				AND (state = 'queued' OR (state = 'running' AND heartbeat_at < now() - $2::interval))
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns,
+		kinds, staleAfter,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Heartbeat persists the current stats of a running job and reports whether it was asked to cancel. It fails with
+// ErrClaimLost once another worker claimed the job.
+func (pgr *PgRepository) Heartbeat(ctx context.Context, job Job, stats any) (bool, error) {
+	var cancelRequested bool
+	err := pgr.db.QueryRow(ctx, `
+		UPDATE jobs SET heartbeat_at = now(), stats = COALESCE($3, stats)
+		WHERE id = $1 AND claim_token = $2 AND state = 'running'
+		RETURNING cancel_requested
+	`, job.ID, job.ClaimToken, marshalStats(stats)).Scan(&cancelRequested)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, ErrClaimLost
+	}
+	return cancelRequested, err
+}
+
+// Finish stores the result of a running job. It fails with ErrClaimLost once another worker claimed the job.
+func (pgr *PgRepository) Finish(ctx context.Context, job Job, state State, stats any, errMsg string) error {
+	tag, err := pgr.db.Exec(ctx, `
+		UPDATE jobs SET state = $3, stats = COALESCE($4, stats), error = NULLIF($5, ''), finished_at = now()
+		WHERE id = $1 AND claim_token = $2 AND state = 'running'
+	`, job.ID, job.ClaimToken, state, marshalStats(stats), errMsg)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrClaimLost
+	}
+	return nil
+}
+
+// marshalStats encodes stats for a jsonb parameter, nil keeps the stored value.
+func marshalStats(stats any) []byte {
+	if stats == nil {
+		return nil
+	}
+	b, err := json.Marshal(stats)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func scanJob(row pgx.Row) (Job, error) {
+	var job Job
+	err := row.Scan(&job.ID, &job.Kind, &job.Repo, &job.Params, &job.State, &job.Stats, &job.Error,
+		&job.CancelRequested, &job.CreatedAt, &job.StartedAt, &job.FinishedAt, &job.ClaimToken)
+	return job, err
+}
@@ -0,0 +1,189 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+type Store interface {
+	Enqueue(ctx context.Context, kind, repo string, params any) (Job, error)
+	Get(ctx context.Context, id int64) (Job, error)
+	Cancel(ctx context.Context, id int64) (Job, error)
+	Claim(ctx context.Context, kinds []string, staleAfter time.Duration) (*Job, error)
+	Heartbeat(ctx context.Context, job Job, stats any) (bool, error)
+	Finish(ctx context.Context, job Job, state State, stats any, errMsg string) error
+}
+
+// Runner is a pool of workers processing queued jobs. Jobs are claimed with `FOR UPDATE SKIP LOCKED`, so several
+// replicas of the service can share the queue.
+type Runner struct {
+	store        Store
+	handlers     map[string]Handler
+	workers      int
+	pollInterval time.Duration
+}
+
+func NewRunner(store Store, workers int, pollInterval time.Duration) *Runner {
+	return &Runner{
+		store:        store,
+		handlers:     map[string]Handler{},
+		workers:      workers,
+		pollInterval: pollInterval,
+	}
+}
+
+// Register sets the handler for jobs of the given kind, it must be called before Run.
+func (r *Runner) Register(kind string, h Handler) {
+	r.handlers[kind] = h
+}
+
+func (r *Runner) Enqueue(ctx context.Context, kind, repo string, params any) (Job, error) {
+	if _, ok := r.handlers[kind]; !ok {
+		return Job{}, fmt.Errorf("no handler for job kind %q", kind)
+	}
+	return r.store.Enqueue(ctx, kind, repo, params)
+}
+
+func (r *Runner) Get(ctx context.Context, id int64) (Job, error) {
+	return r.store.Get(ctx, id)
+}
+
+func (r *Runner) Cancel(ctx context.Context, id int64) (Job, error) {
+	return r.store.Cancel(ctx, id)
+}
+
+// Run starts the workers and blocks until ctx is done.
+func (r *Runner) Run(ctx context.Context) {
+	kinds := make([]string, 0, len(r.handlers))
+	for kind := range r.handlers {
+		kinds = append(kinds, kind)
+	}
+	log.Printf("[jobs] starting %d workers for %v", r.workers, kinds)
+
+	var wg sync.WaitGroup
+	for i := 0; i < r.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.work(ctx, kinds)
+		}()
+	}
+	wg.Wait()
+}
+
+func (r *Runner) work(ctx context.Context, kinds []string) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+	for {
+		job, err := r.store.Claim(ctx, kinds, r.staleAfter())
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[jobs] claim failed: %v", err)
+		}
+		if job != nil {
+			r.process(ctx, *job)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// staleAfter is how long a running job may go without a heartbeat before another worker takes it over.
+func (r *Runner) staleAfter() time.Duration {
+	return 30 * r.heartbeatInterval()
+}
+
+func (r *Runner) heartbeatInterval() time.Duration {
+	return max(r.pollInterval, time.Second)
+}
+
+func (r *Runner) process(ctx context.Context, job Job) {
+	start := time.Now()
+	log.Printf("[jobs] job=%d kind=%s repo=%s started", job.ID, job.Kind, job.Repo)
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu     sync.Mutex
+		latest any
+	)
+	report := func(stats any) {
+		mu.Lock()
+		latest = stats
+		mu.Unlock()
+	}
+	snapshot := func() any {
+		mu.Lock()
+		defer mu.Unlock()
+		return latest
+	}
+
+	var cancelled, lost bool
+	done := make(chan struct{})
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		ticker := time.NewTicker(r.heartbeatInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				cancelRequested, err := r.store.Heartbeat(ctx, job, snapshot())
+				if errors.Is(err, ErrClaimLost) {
+					// Another worker took the job over, this one stops without storing a result.
+					lost = true
+					cancel()
+					return
+				}
+				if err != nil {
+					log.Printf("[jobs] job=%d heartbeat failed: %v", job.ID, err)
+					continue
+				}
+				if cancelRequested {
+					cancelled = true
+					cancel()
+				}
+			}
+		}
+	}()
+
+	stats, err := r.handlers[job.Kind].RunJob(jobCtx, job, report)
+	close(done)
+	<-heartbeatDone
+	if stats == nil {
+		stats = snapshot()
+	}
+
+	if lost {
+		log.Printf("[jobs] job=%d lost to another worker", job.ID)
+		return
+	}
+	if !cancelled && ctx.Err() != nil {
+		// Shutting down: the job stays running and is claimed again once its heartbeat is stale.
+		log.Printf("[jobs] job=%d interrupted by shutdown", job.ID)
+		return
+	}
+
+	state, errMsg := StateSucceeded, ""
+	switch {
+	case cancelled:
+		state = StateCancelled
+	case err != nil:
+		state, errMsg = StateFailed, err.Error()
+	}
+
+	if err := r.store.Finish(context.WithoutCancel(ctx), job, state, stats, errMsg); err != nil {
+		log.Printf("[jobs] job=%d failed to store result: %v", job.ID, err)
+	}
+	log.Printf("[jobs] job=%d kind=%s repo=%s state=%s time=%v", job.ID, job.Kind, job.Repo, state, time.Since(start))
+}
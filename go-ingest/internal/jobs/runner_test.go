@@ -0,0 +1,166 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore is an in-memory Store for a single job. With lost set, the job counts as taken over by another worker.
+type memStore struct {
+	mu       sync.Mutex
+	job      Job
+	claimed  bool
+	lost     bool
+	finished chan struct{}
+}
+
+func newMemStore(kind string) *memStore {
+	return &memStore{job: Job{ID: 1, Kind: kind, State: StateQueued}, finished: make(chan struct{})}
+}
+
+func (m *memStore) Enqueue(context.Context, string, string, any) (Job, error) { return m.job, nil }
+func (m *memStore) Get(context.Context, int64) (Job, error)                   { return m.job, nil }
+
+func (m *memStore) Cancel(context.Context, int64) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.job.CancelRequested = true
+	return m.job, nil
+}
+
+func (m *memStore) Claim(context.Context, []string, time.Duration) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.claimed {
+		return nil, nil
+	}
+	m.claimed = true
+	m.job.State = StateRunning
+	job := m.job
+	return &job, nil
+}
+
+func (m *memStore) Heartbeat(_ context.Context, _ Job, stats any) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lost {
+		return false, ErrClaimLost
+	}
+	m.job.Stats, _ = json.Marshal(stats)
+	return m.job.CancelRequested, nil
+}
+
+func (m *memStore) Finish(_ context.Context, _ Job, state State, stats any, errMsg string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lost {
+		return ErrClaimLost
+	}
+	m.job.State, m.job.Error = state, errMsg
+	m.job.Stats, _ = json.Marshal(stats)
+	close(m.finished)
+	return nil
+}
+
+type handlerFunc func(ctx context.Context, job Job, report ReportFunc) (any, error)
+
+func (f handlerFunc) RunJob(ctx context.Context, job Job, report ReportFunc) (any, error) {
+	return f(ctx, job, report)
+}
+
+func runUntilFinished(t *testing.T, store *memStore, h Handler) Job {
+	t.Helper()
+	r := NewRunner(store, 1, 10*time.Millisecond)
+	r.Register(store.job.Kind, h)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	select {
+	case <-store.finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not finish")
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.job
+}
+
+func TestRunner_RecordsResultOfJob(t *testing.T) {
+	store := newMemStore("test")
+	job := runUntilFinished(t, store, handlerFunc(func(ctx context.Context, job Job, report ReportFunc) (any, error) {
+		return map[string]int{"fetched": 3}, nil
+	}))
+
+	if job.State != StateSucceeded {
+		t.Errorf("expected state %q, got %q", StateSucceeded, job.State)
+	}
+	if string(job.Stats) != `{"fetched":3}` {
+		t.Errorf("unexpected stats %s", job.Stats)
+	}
+}
+
+func TestRunner_RecordsFailure(t *testing.T) {
+	store := newMemStore("test")
+	job := runUntilFinished(t, store, handlerFunc(func(ctx context.Context, job Job, report ReportFunc) (any, error) {
+		return nil, errors.New("upstream down")
+	}))
+
+	if job.State != StateFailed || job.Error != "upstream down" {
+		t.Errorf("expected failed job with error, got state=%q error=%q", job.State, job.Error)
+	}
+}
+
+func TestRunner_CancelsRunningJob(t *testing.T) {
+	store := newMemStore("test")
+	job := runUntilFinished(t, store, handlerFunc(func(ctx context.Context, job Job, report ReportFunc) (any, error) {
+		report(map[string]int{"fetched": 1})
+		_, _ = store.Cancel(ctx, job.ID)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+
+	if job.State != StateCancelled {
+		t.Errorf("expected state %q, got %q", StateCancelled, job.State)
+	}
+	if string(job.Stats) != `{"fetched":1}` {
+		t.Errorf("expected last reported stats, got %s", job.Stats)
+	}
+}
+
+func TestRunner_StopsJobLostToAnotherWorker(t *testing.T) {
+	store := newMemStore("test")
+	store.lost = true
+	r := NewRunner(store, 1, 10*time.Millisecond)
+	returned := make(chan struct{})
+	r.Register("test", handlerFunc(func(ctx context.Context, job Job, report ReportFunc) (any, error) {
+		defer close(returned)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(stopped)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job was not stopped after losing its claim")
+	}
+	cancel()
+	<-stopped
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.job.State != StateRunning {
+		t.Errorf("expected the job to be left to its new owner, got state %q", store.job.State)
+	}
+}
@@ -0,0 +1,107 @@
+package repos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+var (
+	ErrNotFound = errors.New("repo not registered")
+	ErrExists   = errors.New("repo already registered")
+	ErrBusy     = errors.New("repo has a running job, cancel it first")
+)
+
+type Repo struct {
+	Name     string   `json:"name"`
+	Source   string   `json:"source"`
+	Settings Settings `json:"settings"`
+	// WebhookSecret verifies the signature of GitHub webhook deliveries, it is never returned by the API.
+	WebhookSecret    string `json:"-"`
+	HasWebhookSecret bool   `json:"has_webhook_secret"`
+	// EmbeddingModel is the model the repo's issues are embedded and searched with.
+	EmbeddingModel string     `json:"embedding_model"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastSyncedAt   *time.Time `json:"last_synced_at"`
+	IssueCount     int        `json:"issue_count"`
+	EmbeddedCount  int        `json:"embedded_count"`
+	// EmbedFailedCount is the number of issues whose last embedding attempt failed.
+	EmbedFailedCount int `json:"embed_failed_count"`
+}
+
+// Settings are per repo overrides of the service configuration.
+type Settings struct {
+	StrongSimThr *float64 `json:"strong_sim_thr,omitempty"`
+	WeakSimThr   *float64 `json:"weak_sim_thr,omitempty"`
+}
+
+// Thresholds returns the similarity thresholds of the repo, falling back to def for the ones not overridden.
+func (st Settings) Thresholds(def search.Thresholds) search.Thresholds {
+	if st.StrongSimThr != nil {
+		def.Strong = *st.StrongSimThr
+	}
+	if st.WeakSimThr != nil {
+		def.Weak = *st.WeakSimThr
+	}
+	return def
+}
+
+type Store interface {
+	Create(ctx context.Context, repo Repo) (Repo, error)
+	List(ctx context.Context) ([]Repo, error)
+	Get(ctx context.Context, name string) (Repo, error)
+	Lookup(ctx context.Context, name string) (Repo, error)
+	Delete(ctx context.Context, name string) error
+}
+
+type Registry struct {
+	store       Store
+	sources     map[string]bool
+	activeModel string
+}
+
+// NewRegistry creates a registry accepting repos of the given source types. New repos are embedded with activeModel.
+func NewRegistry(store Store, sources []string, activeModel string) *Registry {
+	known := make(map[string]bool, len(sources))
+	for _, src := range sources {
+		known[src] = true
+	}
+	return &Registry{
+		store:       store,
+		sources:     known,
+		activeModel: activeModel,
+	}
+}
+
+func (r *Registry) Create(ctx context.Context, repo Repo) (Repo, error) {
+	if repo.Name == "" {
+		return Repo{}, errors.New("repo required")
+	}
+	if !r.sources[repo.Source] {
+		return Repo{}, fmt.Errorf("unknown source %q", repo.Source)
+	}
+	repo.EmbeddingModel = r.activeModel
+	return r.store.Create(ctx, repo)
+}
+
+func (r *Registry) List(ctx context.Context) ([]Repo, error) {
+	return r.store.List(ctx)
+}
+
+func (r *Registry) Get(ctx context.Context, name string) (Repo, error) {
+	return r.store.Get(ctx, name)
+}
+
+// Lookup resolves a repo like Get but leaves its sync time and issue counts empty, which are costly to count.
+func (r *Registry) Lookup(ctx context.Context, name string) (Repo, error) {
+	return r.store.Lookup(ctx, name)
+}
+
+// Delete unregisters the repo and drops all of its stored issues. It fails with ErrBusy while one of the repo's jobs
+// is running, which would write issues back after the delete; queued jobs are dropped.
+func (r *Registry) Delete(ctx context.Context, name string) error {
+	return r.store.Delete(ctx, name)
+}
@@ -0,0 +1,30 @@
+package repos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+)
+
+func TestSettings_ThresholdsOverridesOnlySetFields(t *testing.T) {
+	strong := 0.9
+	st := Settings{StrongSimThr: &strong}
+
+	got := st.Thresholds(search.Thresholds{Strong: 0.6, Weak: 0.3})
+
+	if got.Strong != 0.9 || got.Weak != 0.3 {
+		t.Errorf("expected {0.9 0.3}, got %+v", got)
+	}
+}
+
+func TestRegistry_CreateRejectsUnknownSource(t *testing.T) {
+	reg := NewRegistry(nil, []string{"mock", "github"}, "reporadar")
+
+	if _, err := reg.Create(context.Background(), Repo{Name: "demo/reporadar", Source: "svn"}); err == nil {
+		t.Error("expected an error for an unknown source")
+	}
+	if _, err := reg.Create(context.Background(), Repo{Source: "github"}); err == nil {
+		t.Error("expected an error for a missing name")
+	}
+}
@@ -0,0 +1,138 @@
+package repos
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PgRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPgRepository(db *pgxpool.Pool) *PgRepository {
+	return &PgRepository{db: db}
+}
+
+const selectRepoSQL = `
+	SELECT r.name, r.source, r.settings, COALESCE(r.webhook_secret, ''), r.embedding_model, r.created_at,
+		(SELECT max(s.synced_at) FROM repo_sync_state s WHERE s.repo = r.name),
+		(SELECT count(*) FROM issues i WHERE i.repo = r.name AND i.deleted_at IS NULL),
+		(SELECT count(*) FROM issues i WHERE i.repo = r.name AND i.deleted_at IS NULL AND i.embedding IS NOT NULL
+			AND i.embedding_model = r.embedding_model),
+		(SELECT count(*) FROM issues i WHERE i.repo = r.name AND i.deleted_at IS NULL AND i.embed_error IS NOT NULL)
+	FROM repos r
+`
+
+// lookupRepoSQL selects the settings of a repo without the counts of selectRepoSQL, which scan all of its issues.
+const lookupRepoSQL = `
+	SELECT name, source, settings, COALESCE(webhook_secret, ''), embedding_model, created_at FROM repos WHERE name = $1
+`
+
+func (pgr *PgRepository) Create(ctx context.Context, repo Repo) (Repo, error) {
+	tag, err := pgr.db.Exec(ctx,
+		`INSERT INTO repos (name, source, settings, webhook_secret, embedding_model) VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		ON CONFLICT (name) DO NOTHING`,
+		repo.Name, repo.Source, repo.Settings, repo.WebhookSecret, repo.EmbeddingModel,
+	)
+	if err != nil {
+		return Repo{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return Repo{}, ErrExists
+	}
+	return pgr.Get(ctx, repo.Name)
+}
+
+func (pgr *PgRepository) List(ctx context.Context) ([]Repo, error) {
+	rows, err := pgr.db.Query(ctx, selectRepoSQL+` ORDER BY r.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Repo{}
+	for rows.Next() {
+		repo, err := scanRepo(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, repo)
+	}
+	return out, rows.Err()
+}
+
+func (pgr *PgRepository) Get(ctx context.Context, name string) (Repo, error) {
+	repo, err := scanRepo(pgr.db.QueryRow(ctx, selectRepoSQL+` WHERE r.name = $1`, name))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Repo{}, ErrNotFound
+	}
+	return repo, err
+}
+
+func (pgr *PgRepository) Lookup(ctx context.Context, name string) (Repo, error) {
+	var repo Repo
+	err := pgr.db.QueryRow(ctx, lookupRepoSQL, name).
+		Scan(&repo.Name, &repo.Source, &repo.Settings, &repo.WebhookSecret, &repo.EmbeddingModel, &repo.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Repo{}, ErrNotFound
+	}
+	repo.HasWebhookSecret = repo.WebhookSecret != ""
+	return repo, err
+}
+
+func (pgr *PgRepository) Delete(ctx context.Context, name string) error {
+	tx, err := pgr.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM repos WHERE name = $1`, name)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	// Locking the repo's jobs keeps a worker from claiming a queued one until the delete commits.
+	var running bool
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(bool_or(state = 'running'), false)
+		FROM (SELECT state FROM jobs WHERE repo = $1 AND state IN ('queued', 'running') FOR UPDATE) j
+	`, name).Scan(&running)
+	if err != nil {
+		return err
+	}
+	if running {
+		return ErrBusy
+	}
+	for _, q := range []string{
+		`DELETE FROM issue_embeddings WHERE issue_id IN (SELECT id FROM issues WHERE repo = $1)`,
+		`DELETE FROM issue_chunks WHERE issue_id IN (SELECT id FROM issues WHERE repo = $1)`,
+		`DELETE FROM comments WHERE repo = $1`,
+		`DELETE FROM pull_requests WHERE repo = $1`,
+		`DELETE FROM issue_pr_links WHERE repo = $1`,
+		`DELETE FROM issues WHERE repo = $1`,
+		`DELETE FROM repo_sync_state WHERE repo = $1`,
+		// Finished jobs stay for GET /jobs/{id}, queued ones are cancelled as the repo is gone.
+		`UPDATE jobs SET state = 'cancelled', cancel_requested = true, finished_at = now(), error = 'repo deleted'
+			WHERE repo = $1 AND state = 'queued'`,
+		`DELETE FROM webhook_deliveries WHERE repo = $1`,
+	} {
+		if _, err := tx.Exec(ctx, q, name); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func scanRepo(row pgx.Row) (Repo, error) {
+	var repo Repo
+	err := row.Scan(&repo.Name, &repo.Source, &repo.Settings, &repo.WebhookSecret, &repo.EmbeddingModel, &repo.CreatedAt,
+		&repo.LastSyncedAt, &repo.IssueCount, &repo.EmbeddedCount, &repo.EmbedFailedCount)
+	repo.HasWebhookSecret = repo.WebhookSecret != ""
+	return repo, err
+}
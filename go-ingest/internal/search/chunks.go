@@ -0,0 +1,30 @@
+package search
+
+import "fmt"
+
+const (
+	AggregateMax = "max"
+	AggregateSum = "sum"
+)
+
+// Aggregation says how the similarities of an issue's chunks make up the issue's similarity in vector search.
+type Aggregation struct {
+	// TopK is the number of best matching chunks whose similarities are summed up, 1 scores an issue by its best
+	// chunk alone.
+	TopK int
+}
+
+// ParseAggregation reads the ChunkAggregation setting: max, or sum of the topK best chunks. Sums of several chunks
+// exceed 1, the similarity thresholds have to be raised accordingly.
+func ParseAggregation(name string, topK int) (Aggregation, error) {
+	switch name {
+	case "", AggregateMax:
+		return Aggregation{TopK: 1}, nil
+	case AggregateSum:
+		if topK < 1 {
+			return Aggregation{}, fmt.Errorf("invalid chunk top k %d", topK)
+		}
+		return Aggregation{TopK: topK}, nil
+	}
+	return Aggregation{}, fmt.Errorf("invalid chunk aggregation %q (max or sum)", name)
+}
@@ -0,0 +1,23 @@
+package search
+
+import "testing"
+
+func TestParseAggregation(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		topK  int
+		want  int
+		valid bool
+	}{
+		{"", 3, 1, true},
+		{"max", 3, 1, true},
+		{"sum", 3, 3, true},
+		{"sum", 0, 0, false},
+		{"mean", 3, 0, false},
+	} {
+		agg, err := ParseAggregation(tc.name, tc.topK)
+		if (err == nil) != tc.valid || agg.TopK != tc.want {
+			t.Errorf("ParseAggregation(%q, %d) = %+v, %v", tc.name, tc.topK, agg, err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package search
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type SortField string
+
+const (
+	SortCreated SortField = "created"
+	SortUpdated SortField = "updated"
+)
+
+type SortOrder string
+
+const (
+	OrderAsc  SortOrder = "asc"
+	OrderDesc SortOrder = "desc"
+)
+
+// Page selects one page of a keyset paginated listing ordered by (sort timestamp, id).
+type Page struct {
+	Limit  int
+	Sort   SortField
+	Order  SortOrder
+	Cursor *Cursor
+}
+
+type IssuePage struct {
+	Issues     []IssueRow `json:"issues"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// Cursor is the position after the last issue of a page. It is bound to the sort it was created for.
+type Cursor struct {
+	Sort  SortField
+	Order SortOrder
+	At    time.Time
+	ID    string
+}
+
+func ParseSort(sort, order string) (SortField, SortOrder, error) {
+	f, o := SortField(sort), SortOrder(order)
+	if f == "" {
+		f = SortCreated
+	}
+	if o == "" {
+		o = OrderAsc
+	}
+	if f != SortCreated && f != SortUpdated {
+		return "", "", fmt.Errorf("invalid sort %q (created or updated)", sort)
+	}
+	if o != OrderAsc && o != OrderDesc {
+		return "", "", fmt.Errorf("invalid order %q (asc or desc)", order)
+	}
+	return f, o, nil
+}
+
+// Encode returns the opaque form of the cursor handed out to clients.
+func (c Cursor) Encode() string {
+	raw := strings.Join([]string{string(c.Sort), string(c.Order), c.At.UTC().Format(time.RFC3339Nano), c.ID}, "|")
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor created by Encode and checks it belongs to the requested sort.
+func DecodeCursor(s string, sort SortField, order SortOrder) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "|", 4)
+	if len(parts) != 4 {
+		return nil, ErrInvalidCursor
+	}
+	at, err := time.Parse(time.RFC3339Nano, parts[2])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := &Cursor{Sort: SortField(parts[0]), Order: SortOrder(parts[1]), At: at, ID: parts[3]}
+	if c.Sort != sort || c.Order != order {
+		return nil, fmt.Errorf("%w: cursor was created for sort=%s order=%s", ErrInvalidCursor, c.Sort, c.Order)
+	}
+	return c, nil
+}
+
+// column is the issues column the listing is sorted by.
+func (f SortField) column() string {
+	if f == SortUpdated {
+		return "i.updated_at"
+	}
+	return "i.created_at"
+}
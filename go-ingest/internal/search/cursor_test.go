@@ -0,0 +1,39 @@
+package search
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	c := Cursor{Sort: SortUpdated, Order: OrderDesc, At: time.Date(2024, 11, 3, 14, 30, 0, 123456000, time.UTC), ID: "42"}
+
+	got, err := DecodeCursor(c.Encode(), SortUpdated, OrderDesc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.ID != "42" || !got.At.Equal(c.At) {
+		t.Errorf("expected %+v, got %+v", c, *got)
+	}
+}
+
+func TestDecodeCursor_RejectsMismatchedSortAndGarbage(t *testing.T) {
+	c := Cursor{Sort: SortCreated, Order: OrderAsc, At: time.Now(), ID: "1"}
+
+	if _, err := DecodeCursor(c.Encode(), SortUpdated, OrderAsc); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor for another sort, got %v", err)
+	}
+	if _, err := DecodeCursor("not a cursor!", SortCreated, OrderAsc); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor for garbage, got %v", err)
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	if f, o, err := ParseSort("", ""); err != nil || f != SortCreated || o != OrderAsc {
+		t.Errorf("expected created/asc default, got %q %q %v", f, o, err)
+	}
+	if _, _, err := ParseSort("title", ""); err == nil {
+		t.Error("expected an error for an unknown sort")
+	}
+}
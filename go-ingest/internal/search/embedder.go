@@ -0,0 +1,78 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrEmbedderUnavailable is wrapped by embedder errors that are expected to go away by themselves: the embedder is
+// down, overloaded or restarting.
+var ErrEmbedderUnavailable = errors.New("embedder unavailable")
+
+// ErrUnknownModel is returned for vectors of a model that no embedder is configured for.
+var ErrUnknownModel = errors.New("unknown embedding model")
+
+// Embedding is a stored vector together with the model that produced it. Vectors of different models are never
+// compared.
+type Embedding struct {
+	Model  string
+	Vector []float32
+}
+
+// Models are the embedders of the configured embedding models by model ID. Besides the active model, models that
+// repos are still served with during a re-index have to be configured.
+type Models struct {
+	// Active is the model new repos start with and re-index jobs switch to by default.
+	Active    string
+	Embedders map[string]Embedder
+}
+
+// SingleModel is a Models with only the active model.
+func SingleModel(id string, embedder Embedder) Models {
+	return Models{Active: id, Embedders: map[string]Embedder{id: embedder}}
+}
+
+// Embedder returns the embedder of the model id, the active model when id is empty.
+func (m Models) Embedder(id string) (string, Embedder, error) {
+	if id == "" {
+		id = m.Active
+	}
+	emb, ok := m.Embedders[id]
+	if !ok {
+		return id, nil, fmt.Errorf("%w %q", ErrUnknownModel, id)
+	}
+	return id, emb, nil
+}
+
+// BatchError reports the items of a batch embedding that failed, keyed by their index in the input. The vectors of
+// the other items are still returned.
+type BatchError struct {
+	Errors map[int]error
+}
+
+func (e *BatchError) Error() string {
+	idx := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	parts := make([]string, 0, min(len(idx), 3))
+	for _, i := range idx[:min(len(idx), 3)] {
+		parts = append(parts, fmt.Sprintf("item %d: %v", i, e.Errors[i]))
+	}
+	if len(idx) > 3 {
+		parts = append(parts, fmt.Sprintf("and %d more", len(idx)-3))
+	}
+	return fmt.Sprintf("%d of the batch failed: %s", len(idx), strings.Join(parts, "; "))
+}
+
+// Unwrap exposes the item errors to errors.Is and errors.As.
+func (e *BatchError) Unwrap() []error {
+	out := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		out = append(out, err)
+	}
+	return out
+}
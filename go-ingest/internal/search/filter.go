@@ -0,0 +1,159 @@
+package search
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter narrows searches and listings down to matching issues. Zero values do not filter.
+type Filter struct {
+	LabelsAny     []string
+	LabelsAll     []string
+	LabelsNone    []string
+	State         string
+	Author        string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	// ExcludeID leaves a single issue out, e.g. the issue duplicates are searched for.
+	ExcludeID string
+}
+
+// FilterError lists the query parameters that could not be parsed.
+type FilterError struct {
+	Params []string
+}
+
+func (e *FilterError) Error() string {
+	return "invalid filter parameters: " + strings.Join(e.Params, ", ")
+}
+
+// ParseFilter reads a Filter from query parameters:
+//
+//	labels_any, labels_all, labels_none   comma separated label names
+//	state                                 open or closed
+//	author                                login of the issue author
+//	created_after, created_before,
+//	updated_after, updated_before         RFC 3339 timestamp, YYYY-MM-DD date or a relative age like 90d or 12h
+func ParseFilter(values url.Values) (Filter, error) {
+	var (
+		f   Filter
+		bad []string
+	)
+	f.LabelsAny = splitList(values.Get("labels_any"))
+	f.LabelsAll = splitList(values.Get("labels_all"))
+	f.LabelsNone = splitList(values.Get("labels_none"))
+	f.Author = strings.TrimSpace(values.Get("author"))
+
+	switch state := values.Get("state"); state {
+	case "", "open", "closed":
+		f.State = state
+	default:
+		bad = append(bad, "state")
+	}
+
+	now := time.Now()
+	for _, p := range []struct {
+		name   string
+		target *time.Time
+	}{
+		{"created_after", &f.CreatedAfter},
+		{"created_before", &f.CreatedBefore},
+		{"updated_after", &f.UpdatedAfter},
+		{"updated_before", &f.UpdatedBefore},
+	} {
+		v := values.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := parseFilterTime(v, now)
+		if err != nil {
+			bad = append(bad, p.name)
+			continue
+		}
+		*p.target = t
+	}
+
+	if len(bad) > 0 {
+		return f, &FilterError{Params: bad}
+	}
+	return f, nil
+}
+
+func parseFilterTime(v string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("invalid age %q", v)
+		}
+		return now.AddDate(0, 0, -n), nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("invalid time %q", v)
+	}
+	return now.Add(-d), nil
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// where renders the filter as SQL conditions on the `issues` table aliased as `i`, each prefixed with AND.
+// Placeholders continue after the given args, which are returned extended with the filter values.
+func (f Filter) where(args []any) (string, []any) {
+	var sb strings.Builder
+	add := func(cond string, v any) {
+		args = append(args, v)
+		sb.WriteString(" AND ")
+		sb.WriteString(strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if len(f.LabelsAny) > 0 {
+		add("i.labels && ?", f.LabelsAny)
+	}
+	if len(f.LabelsAll) > 0 {
+		add("i.labels @> ?", f.LabelsAll)
+	}
+	if len(f.LabelsNone) > 0 {
+		add("NOT (COALESCE(i.labels, '{}') && ?)", f.LabelsNone)
+	}
+	if f.State != "" {
+		add("i.state = ?", f.State)
+	}
+	if f.Author != "" {
+		add("i.author = ?", f.Author)
+	}
+	if !f.CreatedAfter.IsZero() {
+		add("i.created_at >= ?", f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		add("i.created_at < ?", f.CreatedBefore)
+	}
+	if !f.UpdatedAfter.IsZero() {
+		add("i.updated_at >= ?", f.UpdatedAfter)
+	}
+	if !f.UpdatedBefore.IsZero() {
+		add("i.updated_at < ?", f.UpdatedBefore)
+	}
+	if f.ExcludeID != "" {
+		add("i.id <> ?", f.ExcludeID)
+	}
+	return sb.String(), args
+}
@@ -0,0 +1,67 @@
+package search
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFilter(t *testing.T) {
+	values := url.Values{
+		"labels_any":    {"bug, crash"},
+		"labels_none":   {"wontfix"},
+		"state":         {"open"},
+		"author":        {"octocat"},
+		"created_after": {"90d"},
+		"updated_after": {"2024-11-01"},
+	}
+
+	f, err := ParseFilter(values)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(f.LabelsAny, []string{"bug", "crash"}) || !reflect.DeepEqual(f.LabelsNone, []string{"wontfix"}) {
+		t.Errorf("unexpected labels any=%v none=%v", f.LabelsAny, f.LabelsNone)
+	}
+	if f.State != "open" || f.Author != "octocat" {
+		t.Errorf("unexpected state=%q author=%q", f.State, f.Author)
+	}
+	if age := time.Since(f.CreatedAfter); age < 89*24*time.Hour || age > 91*24*time.Hour {
+		t.Errorf("expected created_after 90 days ago, got %v", f.CreatedAfter)
+	}
+	if !f.UpdatedAfter.Equal(time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected updated_after %v", f.UpdatedAfter)
+	}
+}
+
+func TestParseFilter_ListsAllMalformedParams(t *testing.T) {
+	_, err := ParseFilter(url.Values{
+		"state":          {"pending"},
+		"created_before": {"yesterday"},
+		"updated_after":  {"2024-11-01T10:00:00Z"},
+	})
+
+	var fe *FilterError
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected a FilterError, got %v", err)
+	}
+	if !reflect.DeepEqual(fe.Params, []string{"state", "created_before"}) {
+		t.Errorf("expected [state created_before], got %v", fe.Params)
+	}
+}
+
+func TestFilter_WhereContinuesPlaceholders(t *testing.T) {
+	f := Filter{LabelsAll: []string{"bug"}, State: "closed", ExcludeID: "7"}
+
+	where, args := f.where([]any{"demo/reporadar", 10})
+
+	want := " AND i.labels @> $3 AND i.state = $4 AND i.id <> $5"
+	if where != want {
+		t.Errorf("expected %q, got %q", want, where)
+	}
+	if len(args) != 5 || args[4] != "7" {
+		t.Errorf("unexpected args %v", args)
+	}
+}
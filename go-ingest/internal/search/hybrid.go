@@ -0,0 +1,111 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+)
+
+type Mode string
+
+const (
+	ModeVector  Mode = "vector"
+	ModeLexical Mode = "lexical"
+	ModeHybrid  Mode = "hybrid"
+)
+
+// rrfK dampens the influence of the top ranks in reciprocal rank fusion, 60 is the value from the original paper.
+const rrfK = 60
+
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case "":
+		return ModeVector, nil
+	case ModeVector, ModeLexical, ModeHybrid:
+		return Mode(s), nil
+	}
+	return "", fmt.Errorf("invalid mode %q (vector, lexical or hybrid)", s)
+}
+
+// RankLexical turns full-text hits, ordered by text rank, into results. Without a vector there is no similarity, so
+// every hit is classified as a lexical match.
+func RankLexical(hits []IssueRow, limit int) []Result {
+	out := make([]Result, 0, min(len(hits), limit))
+	for i, hit := range hits {
+		if len(out) >= limit {
+			break
+		}
+		rank := hit.TextRank
+		res := newResult(hit)
+		res.Confidence = ConfidenceLexical
+		res.Scores = Scores{Lexical: &rank, LexicalRank: i + 1}
+		res.MatchReasons = []string{MatchLexical}
+		out = append(out, res)
+	}
+	return out
+}
+
+// FuseRRF combines the vector leg (ordered by distance) and the lexical leg (ordered by text rank) with reciprocal
+// rank fusion: every result scores sum(1 / (rrfK + rank)) over the legs that found it, and results are ordered by
+// that score. Confidence still comes from the vector similarity, which lexical hits carry when they have an
+// embedding. Vector-only hits below the weak threshold are dropped, lexical hits are kept as ConfidenceLexical.
+func FuseRRF(vector, lexical []IssueRow, limit int, thresholds Thresholds) []Result {
+	byID := map[string]*Result{}
+	var order []string
+	get := func(iss IssueRow) *Result {
+		if res, ok := byID[iss.ID]; ok {
+			return res
+		}
+		res := newResult(iss)
+		byID[iss.ID] = &res
+		order = append(order, iss.ID)
+		return &res
+	}
+	setSimilarity := func(res *Result, distance float64) {
+		sim := -distance
+		res.Similarity = sim
+		res.Scores.Vector = &sim
+	}
+
+	for i, iss := range vector {
+		res := get(iss)
+		setSimilarity(res, iss.Distance)
+		res.Snippet, res.Comment = iss.Snippet, iss.Comment
+		res.MatchReasons = append(res.MatchReasons, MatchEmbedding)
+		res.Scores.VectorRank = i + 1
+		res.Scores.Fused += 1.0 / float64(rrfK+i+1)
+	}
+	for i, iss := range lexical {
+		res := get(iss)
+		if res.Scores.Vector == nil && iss.HasDistance {
+			setSimilarity(res, iss.Distance)
+		}
+		rank := iss.TextRank
+		res.MatchReasons = append(res.MatchReasons, MatchLexical)
+		res.Scores.Lexical = &rank
+		res.Scores.LexicalRank = i + 1
+		res.Scores.Fused += 1.0 / float64(rrfK+i+1)
+	}
+
+	out := make([]Result, 0, len(order))
+	for _, id := range order {
+		res := byID[id]
+		switch {
+		case res.Scores.Vector != nil && res.Similarity >= thresholds.Strong:
+			res.Confidence = ConfidenceStrong
+		case res.Scores.Vector != nil && res.Similarity >= thresholds.Weak:
+			res.Confidence = ConfidenceWeak
+		case res.Scores.LexicalRank > 0:
+			res.Confidence = ConfidenceLexical
+		default:
+			continue
+		}
+		out = append(out, *res)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Scores.Fused > out[j].Scores.Fused
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package search
+
+import "testing"
+
+func TestFuseRRF_CombinesLegsAndKeepsExactMatches(t *testing.T) {
+	thr := Thresholds{Strong: 0.6, Weak: 0.3}
+	vector := []IssueRow{
+		{ID: "1", Title: "Login crash", Distance: -0.7}, // sim 0.7, strong
+		{ID: "2", Title: "Dark mode", Distance: -0.35},  // sim 0.35, weak
+		{ID: "4", Title: "Unrelated", Distance: -0.1},   // sim 0.1, dropped
+	}
+	lexical := []IssueRow{
+		// exact error code match with low semantic similarity
+		{ID: "3", Title: "ERR_SSL_PROTOCOL on proxy", TextRank: 0.9, Distance: -0.2, HasDistance: true},
+		{ID: "2", Title: "Dark mode", TextRank: 0.4, Distance: -0.35, HasDistance: true},
+	}
+
+	got := FuseRRF(vector, lexical, 10, thr)
+
+	if len(got) != 3 {
+		t.Fatalf("expected 3 results, got %d: %+v", len(got), got)
+	}
+	// "2" is found by both legs and wins the fusion.
+	if got[0].ID != "2" || got[0].Scores.VectorRank != 2 || got[0].Scores.LexicalRank != 2 {
+		t.Errorf("expected ID=2 first with ranks from both legs, got %+v", got[0])
+	}
+	if got[0].Scores.Lexical == nil || *got[0].Scores.Lexical != 0.4 {
+		t.Errorf("expected lexical score 0.4, got %v", got[0].Scores.Lexical)
+	}
+	byID := map[string]Result{}
+	for _, res := range got {
+		byID[res.ID] = res
+	}
+	if byID["1"].Confidence != ConfidenceStrong {
+		t.Errorf("expected ID=1 strong, got %q", byID["1"].Confidence)
+	}
+	if res, ok := byID["3"]; !ok || res.Confidence != ConfidenceLexical || res.Similarity != 0.2 {
+		t.Errorf("expected ID=3 kept as lexical match with similarity 0.2, got %+v", res)
+	}
+	if _, ok := byID["4"]; ok {
+		t.Error("expected ID=4 below the weak threshold to be dropped")
+	}
+}
+
+func TestFuseRRF_RespectsLimit(t *testing.T) {
+	vector := []IssueRow{{ID: "1", Distance: -0.9}, {ID: "2", Distance: -0.8}}
+	lexical := []IssueRow{{ID: "3", TextRank: 1}}
+
+	got := FuseRRF(vector, lexical, 2, Thresholds{Strong: 0.6, Weak: 0.3})
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(got))
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	if m, err := ParseMode(""); err != nil || m != ModeVector {
+		t.Errorf("expected default mode vector, got %q, %v", m, err)
+	}
+	if m, err := ParseMode("hybrid"); err != nil || m != ModeHybrid {
+		t.Errorf("expected hybrid, got %q, %v", m, err)
+	}
+	if _, err := ParseMode("fuzzy"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
@@ -2,49 +2,305 @@ package search
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/zanmajeric/reporadar-go-ingest/utils"
 )
 
 type PgRepository struct {
 	db *pgxpool.Pool
+	// iterativeScan is set by EnsureVectorIndex when pgvector supports iterative index scans.
+	iterativeScan bool
 }
 
 func NewPgRepository(db *pgxpool.Pool) *PgRepository {
 	return &PgRepository{db: db}
 }
 
-// SearchByVector NOTE: embeddings are L2-normalized and we use pgvector `<=>` (inner product distance).
-func (pgr *PgRepository) SearchByVector(ctx context.Context, repo string, vector []float32, limit int) ([]IssueRow, error) {
-	vectorLiteral := utils.EmbeddingToVectorLiteral(vector)
+// lifecycleColumns selects the lifecycle fields of issue i, in the order of IssueRow.lifecycle.
+const lifecycleColumns = `COALESCE(i.state, ''), COALESCE(i.author, ''), COALESCE(i.assignees, '{}'),
+	COALESCE(i.milestone, ''), i.closed_at, COALESCE(i.close_reason, '')`
 
-	const qSQL = `
-		SELECT id, repo, title, body, embedding <#> $1::vector AS distance
-		FROM issues
-		WHERE repo = $2
-		ORDER BY embedding <#> $1::vector
+// lifecycle returns the scan destinations of lifecycleColumns.
+func (r *IssueRow) lifecycle() []any {
+	return []any{&r.State, &r.Author, &r.Assignees, &r.Milestone, &r.ClosedAt, &r.CloseReason}
+}
+
+// SearchByVector NOTE: embeddings are L2-normalized and we use pgvector `<#>` (inner product distance).
+// The distance of an issue is the sum of the distances of its agg.TopK closest chunks, its closest chunk is the
+// snippet. Only chunks of the model of the issue's current embedding are searched, and only the nearestChunks closest
+// of them, found through the index of EnsureVectorIndex. The filter is applied before the LIMIT.
+func (pgr *PgRepository) SearchByVector(ctx context.Context, repo string, emb Embedding, limit int, f Filter, agg Aggregation) ([]IssueRow, error) {
+	vectorLiteral := utils.EmbeddingToVectorLiteral(emb.Vector)
+	nearest := nearestChunks(limit, agg, pgr.iterativeScan)
+	// The same expression as the index, see EnsureVectorIndex
+	distance := fmt.Sprintf("(c.embedding::vector(%[1]d)) <#> $1::vector(%[1]d)", len(emb.Vector))
+
+	where, args := f.where([]any{vectorLiteral, repo, limit, emb.Model, max(agg.TopK, 1), nearest})
+	qSQL := `
+		WITH nearest AS MATERIALIZED (
+			SELECT c.issue_id, c.chunk_index, c.text, c.comment_id, ` + distance + ` AS distance
+			FROM issue_chunks c
+			JOIN issues i ON i.id = c.issue_id AND i.embedding_model = c.model
+			WHERE i.repo = $2 AND i.deleted_at IS NULL AND c.model = $4` + where + `
+			ORDER BY ` + distance + `
+			LIMIT $6
+		), hits AS (
+			SELECT issue_id, text, comment_id, distance,
+				row_number() OVER (PARTITION BY issue_id ORDER BY distance, chunk_index) AS rank
+			FROM nearest
+		), scored AS (
+			SELECT issue_id, sum(distance) AS distance, min(text) FILTER (WHERE rank = 1) AS snippet,
+				min(comment_id) FILTER (WHERE rank = 1) AS comment_id
+			FROM hits
+			WHERE rank <= $5
+			GROUP BY issue_id
+		)
+		SELECT i.id, i.repo, i.title, COALESCE(i.body, ''), s.distance, s.snippet,
+			cm.id, COALESCE(cm.author, ''), cm.created_at, ` + lifecycleColumns + `
+		FROM scored s
+		JOIN issues i ON i.id = s.issue_id
+		LEFT JOIN comments cm ON cm.id = s.comment_id
+		ORDER BY s.distance, i.id
 		LIMIT $3;
 	`
 
+	// An HNSW index scan returns at most hnsw.ef_search rows, unless it is iterative: then it goes on until the LIMIT
+	// of nearest is reached.
+	tx, err := pgr.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	settings := []string{fmt.Sprintf("SET LOCAL hnsw.ef_search = %d", min(nearest, maxEfSearch))}
+	if pgr.iterativeScan {
+		settings = append(settings, "SET LOCAL hnsw.iterative_scan = relaxed_order")
+	}
+	for _, q := range settings {
+		if _, err := tx.Exec(ctx, q); err != nil {
+			return nil, err
+		}
+	}
+
 	sqlStartTime := time.Now()
-	rows, err := pgr.db.Query(ctx, qSQL, vectorLiteral, repo, limit)
+	rows, err := tx.Query(ctx, qSQL, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	sqlProcTime := time.Since(sqlStartTime)
 	log.Printf("searchByVector sql time: %v", sqlProcTime)
 
 	var results []IssueRow
+	for rows.Next() {
+		var (
+			r                IssueRow
+			commentID        *string
+			commentAuthor    string
+			commentCreatedAt *time.Time
+		)
+		dest := []any{&r.ID, &r.Repo, &r.Title, &r.Body, &r.Distance, &r.Snippet, &commentID, &commentAuthor, &commentCreatedAt}
+		if err := rows.Scan(append(dest, r.lifecycle()...)...); err != nil {
+			return nil, err
+		}
+		if commentID != nil && commentCreatedAt != nil {
+			r.Comment = &CommentMatch{ID: *commentID, Author: commentAuthor, CreatedAt: *commentCreatedAt}
+		}
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
+
+// SearchByText is the full-text leg of the search, hits are ordered by `ts_rank_cd`. When emb is given, the distance
+// of every hit embedded with the same model is returned as well.
+func (pgr *PgRepository) SearchByText(ctx context.Context, repo, text string, emb *Embedding, limit int, f Filter) ([]IssueRow, error) {
+	var vectorLiteral, model *string
+	if emb != nil {
+		l := utils.EmbeddingToVectorLiteral(emb.Vector)
+		vectorLiteral, model = &l, &emb.Model
+	}
+
+	where, args := f.where([]any{text, repo, limit, vectorLiteral, model})
+	qSQL := `
+		SELECT i.id, i.repo, i.title, COALESCE(i.body, ''), ts_rank_cd(i.search_tsv, query) AS rank,
+			CASE WHEN i.embedding_model = $5 THEN i.embedding <#> $4::vector END AS distance, ` + lifecycleColumns + `
+		FROM issues i, websearch_to_tsquery('english', $1) query
+		WHERE i.repo = $2 AND i.deleted_at IS NULL AND i.search_tsv @@ query` + where + `
+		ORDER BY rank DESC, i.id
+		LIMIT $3;
+	`
+
+	sqlStartTime := time.Now()
+	rows, err := pgr.db.Query(ctx, qSQL, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	log.Printf("searchByText sql time: %v", time.Since(sqlStartTime))
+
+	var results []IssueRow
+	for rows.Next() {
+		var (
+			r        IssueRow
+			distance *float64
+		)
+		if err := rows.Scan(append([]any{&r.ID, &r.Repo, &r.Title, &r.Body, &r.TextRank, &distance}, r.lifecycle()...)...); err != nil {
+			return nil, err
+		}
+		if distance != nil {
+			r.Distance, r.HasDistance = *distance, true
+		}
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
+
+// ListIssues returns one page of the issues of repo matching the filter. Bodies are not loaded.
+func (pgr *PgRepository) ListIssues(ctx context.Context, repo string, f Filter, page Page) (IssuePage, error) {
+	where, args := f.where([]any{repo, page.Limit + 1})
+	col, cmp, dir := page.Sort.column(), ">", "ASC"
+	if page.Order == OrderDesc {
+		cmp, dir = "<", "DESC"
+	}
+	if page.Cursor != nil {
+		args = append(args, page.Cursor.At, page.Cursor.ID)
+		where += fmt.Sprintf(" AND (%s, i.id) %s ($%d, $%d)", col, cmp, len(args)-1, len(args))
+	}
+	qSQL := `
+		SELECT i.id, i.repo, COALESCE(i.number, 0), i.title, COALESCE(i.labels, '{}'), i.created_at, i.updated_at,
+			` + lifecycleColumns + `
+		FROM issues i
+		WHERE i.repo = $1 AND i.deleted_at IS NULL` + where + `
+		ORDER BY ` + col + ` ` + dir + `, i.id ` + dir + `
+		LIMIT $2
+	`
+	rows, err := pgr.db.Query(ctx, qSQL, args...)
+	if err != nil {
+		return IssuePage{}, err
+	}
+	defer rows.Close()
+
+	out := IssuePage{Issues: []IssueRow{}}
 	for rows.Next() {
 		var r IssueRow
-		if err := rows.Scan(&r.ID, &r.Repo, &r.Title, &r.Body, &r.Distance); err != nil {
+		dest := []any{&r.ID, &r.Repo, &r.Number, &r.Title, &r.Labels, &r.CreatedAt, &r.UpdatedAt}
+		if err := rows.Scan(append(dest, r.lifecycle()...)...); err != nil {
+			return IssuePage{}, err
+		}
+		out.Issues = append(out.Issues, r)
+	}
+	if err := rows.Err(); err != nil {
+		return IssuePage{}, err
+	}
+
+	if len(out.Issues) > page.Limit {
+		out.Issues = out.Issues[:page.Limit]
+		last := out.Issues[len(out.Issues)-1]
+		next := Cursor{Sort: page.Sort, Order: page.Order, At: last.CreatedAt, ID: last.ID}
+		if page.Sort == SortUpdated {
+			next.At = last.UpdatedAt
+		}
+		out.NextCursor = next.Encode()
+	}
+	return out, nil
+}
+
+func (pgr *PgRepository) GetIssue(ctx context.Context, id string) (IssueRow, error) {
+	const qSQL = `
+		SELECT i.id, i.repo, COALESCE(i.number, 0), i.title, COALESCE(i.body, ''), COALESCE(i.normalized_body, ''),
+			COALESCE(i.labels, '{}'), i.created_at, i.updated_at, COALESCE(i.stack_fingerprint, ''), ` + lifecycleColumns + `
+		FROM issues i
+		WHERE i.id = $1 AND i.deleted_at IS NULL
+	`
+	var r IssueRow
+	dest := []any{&r.ID, &r.Repo, &r.Number, &r.Title, &r.Body, &r.NormalizedBody, &r.Labels, &r.CreatedAt, &r.UpdatedAt,
+		&r.Fingerprint}
+	err := pgr.db.QueryRow(ctx, qSQL, id).Scan(append(dest, r.lifecycle()...)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return r, ErrIssueNotFound
+	}
+	return r, err
+}
+
+// GetEmbedding returns the stored embedding of an issue, or ErrNoEmbedding when it has not been computed yet.
+func (pgr *PgRepository) GetEmbedding(ctx context.Context, id string) (Embedding, error) {
+	var literal, model *string
+	err := pgr.db.QueryRow(ctx, `SELECT embedding::text, embedding_model FROM issues WHERE id = $1 AND deleted_at IS NULL`, id).
+		Scan(&literal, &model)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Embedding{}, ErrIssueNotFound
+	}
+	if err != nil {
+		return Embedding{}, err
+	}
+	if literal == nil || model == nil {
+		return Embedding{}, ErrNoEmbedding
+	}
+	vec, err := utils.VectorLiteralToEmbedding(*literal)
+	if err != nil {
+		return Embedding{}, err
+	}
+	return Embedding{Model: *model, Vector: vec}, nil
+}
+
+func (pgr *PgRepository) SearchByFingerprint(ctx context.Context, repo, fingerprint string, limit int, f Filter) ([]IssueRow, error) {
+	where, args := f.where([]any{repo, fingerprint, limit})
+	qSQL := `
+		SELECT i.id, i.repo, i.title, COALESCE(i.body, ''), i.stack_fingerprint, ` + lifecycleColumns + `
+		FROM issues i
+		WHERE i.repo = $1 AND i.stack_fingerprint = $2 AND i.deleted_at IS NULL` + where + `
+		ORDER BY i.updated_at DESC, i.id
+		LIMIT $3
+	`
+	rows, err := pgr.db.Query(ctx, qSQL, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []IssueRow
+	for rows.Next() {
+		var r IssueRow
+		if err := rows.Scan(append([]any{&r.ID, &r.Repo, &r.Title, &r.Body, &r.Fingerprint}, r.lifecycle()...)...); err != nil {
 			return nil, err
 		}
 		results = append(results, r)
 	}
+	return results, rows.Err()
+}
 
-	return results, nil
+func (pgr *PgRepository) LinkedPullRequests(ctx context.Context, ids []string) (map[string][]LinkedPR, error) {
+	const qSQL = `
+		SELECT i.id, p.number, p.title, p.state, COALESCE(p.url, ''), p.merged_at
+		FROM issues i
+		JOIN issue_pr_links l ON l.repo = i.repo AND l.issue_number = i.number
+		JOIN pull_requests p ON p.repo = l.repo AND p.number = l.pr_number
+		WHERE i.id = ANY($1)
+		ORDER BY i.id, p.number
+	`
+	rows, err := pgr.db.Query(ctx, qSQL, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string][]LinkedPR{}
+	for rows.Next() {
+		var (
+			id string
+			pr LinkedPR
+		)
+		if err := rows.Scan(&id, &pr.Number, &pr.Title, &pr.State, &pr.URL, &pr.MergedAt); err != nil {
+			return nil, err
+		}
+		out[id] = append(out[id], pr)
+	}
+	return out, rows.Err()
 }
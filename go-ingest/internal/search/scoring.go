@@ -1,12 +1,27 @@
 package search
 
-import "log"
+import (
+	"log"
+	"sort"
+	"time"
+)
 
 type Confidence string
 
 const (
 	ConfidenceStrong Confidence = "strong"
 	ConfidenceWeak   Confidence = "weak"
+	// ConfidenceLexical marks results that matched the query terms without being semantically similar enough.
+	ConfidenceLexical Confidence = "lexical"
+)
+
+// Reasons a result matched, see Result.MatchReasons.
+const (
+	MatchEmbedding = "embedding"
+	MatchLexical   = "lexical"
+	// MatchStackTrace marks issues with the same stack trace fingerprint as the query or the issue duplicates are
+	// searched for.
+	MatchStackTrace = "stack_trace"
 )
 
 type Result struct {
@@ -16,21 +31,63 @@ type Result struct {
 	Body       string     `json:"body"`
 	Similarity float64    `json:"similarity"`
 	Confidence Confidence `json:"confidence"`
+	Scores     Scores     `json:"scores"`
+	// Snippet is the chunk of the issue that matched the query best.
+	Snippet string `json:"snippet,omitempty"`
+	// MatchReasons tell how the result was found: MatchEmbedding, MatchLexical and/or MatchStackTrace.
+	MatchReasons []string `json:"match_reasons"`
+	// Comment is set when the Snippet is an excerpt of one of the issue's comments rather than of the issue itself.
+	Comment *CommentMatch `json:"comment,omitempty"`
+	// Fixed marks issues closed as completed, see IssueRow.Fixed.
+	Fixed bool `json:"fixed"`
+	// Lifecycle of the issue, see IssueRow.
+	State       string     `json:"state,omitempty"`
+	Author      string     `json:"author,omitempty"`
+	Assignees   []string   `json:"assignees,omitempty"`
+	Milestone   string     `json:"milestone,omitempty"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+	CloseReason string     `json:"close_reason,omitempty"`
+	// PullRequests are the pull requests linked to the issue, e.g. a fix in flight.
+	PullRequests []LinkedPR `json:"pull_requests,omitempty"`
+}
+
+// newResult returns the result for an issue, without scores.
+func newResult(iss IssueRow) Result {
+	return Result{
+		ID:          iss.ID,
+		Repo:        iss.Repo,
+		Title:       iss.Title,
+		Body:        iss.Body,
+		Fixed:       iss.Fixed(),
+		State:       iss.State,
+		Author:      iss.Author,
+		Assignees:   iss.Assignees,
+		Milestone:   iss.Milestone,
+		ClosedAt:    iss.ClosedAt,
+		CloseReason: iss.CloseReason,
+	}
+}
+
+// Scores are the per leg scores of a result. Ranks are 1-based, zero when the result was not found by that leg.
+type Scores struct {
+	Vector      *float64 `json:"vector,omitempty"`
+	VectorRank  int      `json:"vector_rank,omitempty"`
+	Lexical     *float64 `json:"lexical,omitempty"`
+	LexicalRank int      `json:"lexical_rank,omitempty"`
+	Fused       float64  `json:"fused,omitempty"`
 }
 
 // ScoreAndRank For normalized vectors, distance = -dot(u, v), so we define similarity = -distance ∈ [-1, 1].
 func ScoreAndRank(issues []IssueRow, limit int, thresholds Thresholds) []Result {
 	var strong []Result
 	var weak []Result
-	for _, issue := range issues {
+	for i, issue := range issues {
 		sim := -issue.Distance
-		res := Result{
-			ID:         issue.ID,
-			Repo:       issue.Repo,
-			Title:      issue.Title,
-			Body:       issue.Body,
-			Similarity: sim,
-		}
+		res := newResult(issue)
+		res.Snippet, res.Comment = issue.Snippet, issue.Comment
+		res.Similarity = sim
+		res.Scores = Scores{Vector: &sim, VectorRank: i + 1}
+		res.MatchReasons = []string{MatchEmbedding}
 		log.Printf("issue: [ %v ] \n distance: %v | similarity: %v", res.Title, issue.Distance, res.Similarity)
 		switch {
 		case sim >= thresholds.Strong:
@@ -61,3 +118,58 @@ func ScoreAndRank(issues []IssueRow, limit int, thresholds Thresholds) []Result
 
 	return out
 }
+
+// PromoteStackMatches puts the issues sharing a stack trace fingerprint with the query (matches) first, as strong
+// results: the same crash is a better signal than any similarity. Matches already in results keep their scores and
+// order, the others follow; the remaining results come last.
+func PromoteStackMatches(results []Result, matches []IssueRow, limit int) []Result {
+	if len(matches) == 0 {
+		return results
+	}
+	matched := make(map[string]bool, len(matches))
+	for _, m := range matches {
+		matched[m.ID] = true
+	}
+
+	out := make([]Result, 0, len(results)+len(matches))
+	promoted := map[string]bool{}
+	promote := func(res Result) {
+		res.Confidence = ConfidenceStrong
+		res.MatchReasons = append(res.MatchReasons, MatchStackTrace)
+		out = append(out, res)
+		promoted[res.ID] = true
+	}
+	for _, res := range results {
+		if matched[res.ID] {
+			promote(res)
+		}
+	}
+	for _, m := range matches {
+		if !promoted[m.ID] {
+			promote(newResult(m))
+		}
+	}
+	for _, res := range results {
+		if !promoted[res.ID] {
+			out = append(out, res)
+		}
+	}
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// PreferFixed moves the results of issues closed as fixed ahead of the others of the same confidence, keeping the
+// order otherwise: pointing a reporter at the fix of their problem is the most useful duplicate.
+func PreferFixed(results []Result) []Result {
+	tier := map[Confidence]int{ConfidenceStrong: 0, ConfidenceWeak: 1, ConfidenceLexical: 2}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if tier[a.Confidence] != tier[b.Confidence] {
+			return tier[a.Confidence] < tier[b.Confidence]
+		}
+		return a.Fixed && !b.Fixed
+	})
+	return results
+}
@@ -2,36 +2,110 @@ package search
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/zanmajeric/reporadar-go-ingest/config"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/stacktrace"
 )
 
 type Embedder interface {
 	Embed(ctx context.Context, text string) ([]float32, error)
+	// EmbedBatch embeds texts in order. When only some items fail, the vectors of the others are returned together
+	// with a *BatchError.
+	EmbedBatch(ctx context.Context, texts []string) ([][]float32, error)
 }
 
+var (
+	ErrIssueNotFound = errors.New("issue not found")
+	ErrNoEmbedding   = errors.New("issue has no embedding yet")
+)
+
 type IssueRepository interface {
-	SearchByVector(ctx context.Context, repo string, vector []float32, limit int) ([]IssueRow, error)
+	// SearchByVector compares emb to the chunks of the issues embedded with its model and scores every issue by its
+	// best matching chunks as set by agg.
+	SearchByVector(ctx context.Context, repo string, emb Embedding, limit int, f Filter, agg Aggregation) ([]IssueRow, error)
+	SearchByText(ctx context.Context, repo, text string, emb *Embedding, limit int, f Filter) ([]IssueRow, error)
+	ListIssues(ctx context.Context, repo string, f Filter, page Page) (IssuePage, error)
+	GetIssue(ctx context.Context, id string) (IssueRow, error)
+	GetEmbedding(ctx context.Context, id string) (Embedding, error)
+	// SearchByFingerprint returns the issues of repo with the stack trace fingerprint, most recently updated first.
+	SearchByFingerprint(ctx context.Context, repo, fingerprint string, limit int, f Filter) ([]IssueRow, error)
+	// LinkedPullRequests returns the pull requests linked to the issues, by issue id.
+	LinkedPullRequests(ctx context.Context, ids []string) (map[string][]LinkedPR, error)
 }
 
 type IssueRow struct {
 	ID        string    `json:"id"`
 	Repo      string    `json:"repo"`
+	Number    int       `json:"number,omitempty"`
 	Title     string    `json:"title"`
-	Body      string    `json:"body"`
+	Body      string    `json:"body,omitempty"`
 	Labels    []string  `json:"labels"`
+	State     string    `json:"state,omitempty"`
+	Author    string    `json:"author,omitempty"`
+	Assignees []string  `json:"assignees,omitempty"`
+	Milestone string    `json:"milestone,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt string    `json:"updated_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 	Distance  float64   //embedding
+	// HasDistance is false for full-text hits that could not be compared to the query vector.
+	HasDistance bool    `json:"-"`
+	TextRank    float64 `json:"-"`
+	// Snippet is the best matching chunk of a vector hit.
+	Snippet string `json:"-"`
+	// NormalizedBody is the body as it was embedded, see package textnorm.
+	NormalizedBody string `json:"normalized_body,omitempty"`
+	// BodyFormat is the markup of Body when it is not markdown, e.g. textnorm.FormatJiraWiki.
+	BodyFormat string `json:"-"`
+	// Fingerprint identifies the first stack trace in the body, see package stacktrace.
+	Fingerprint string `json:"stack_fingerprint,omitempty"`
+	// Comment is the comment the Snippet of a vector hit is part of.
+	Comment *CommentMatch `json:"-"`
+	// ClosedAt is when a closed issue was closed.
+	ClosedAt *time.Time `json:"closed_at,omitempty"`
+	// CloseReason tells why a closed issue was closed, e.g. CloseReasonCompleted.
+	CloseReason string `json:"close_reason,omitempty"`
+	// PullRequests are the pull requests linked to the issue, only loaded by Service.GetIssue.
+	PullRequests []LinkedPR `json:"pull_requests,omitempty"`
+}
+
+// LinkedPR is a pull request that fixes an issue, according to a closing reference or a cross-reference.
+type LinkedPR struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	// State is open, closed or merged.
+	State    string     `json:"state"`
+	URL      string     `json:"url,omitempty"`
+	MergedAt *time.Time `json:"merged_at,omitempty"`
+}
+
+// Reasons an issue was closed, see IssueRow.CloseReason. Sources map their own resolutions onto these.
+const (
+	CloseReasonCompleted  = "completed"
+	CloseReasonNotPlanned = "not_planned"
+	CloseReasonDuplicate  = "duplicate"
+)
+
+// Fixed reports whether the issue was closed as completed, i.e. whatever it reported has been fixed or done.
+func (r IssueRow) Fixed() bool {
+	return r.State == "closed" && r.CloseReason == CloseReasonCompleted
+}
+
+// CommentMatch is the comment of an issue that matched a query.
+type CommentMatch struct {
+	ID        string    `json:"id"`
+	Author    string    `json:"author,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type Service struct {
-	embedder Embedder
-	repo     IssueRepository
-	cfg      *config.AppConfig
+	models Models
+	repo   IssueRepository
+	cfg    *config.AppConfig
+	agg    Aggregation
 }
 
 type Thresholds struct {
@@ -39,29 +113,196 @@ type Thresholds struct {
 	Weak   float64
 }
 
-func New(embedder Embedder, issuesRep IssueRepository, cfg config.AppConfig) *Service {
+func New(models Models, issuesRep IssueRepository, cfg config.AppConfig) *Service {
+	agg, err := ParseAggregation(cfg.ChunkAggregation, cfg.ChunkTopK)
+	if err != nil {
+		log.Printf("WARNING: %v, issues are scored by their best chunk", err)
+		agg = Aggregation{TopK: 1}
+	}
 	return &Service{
-		embedder: embedder,
-		repo:     issuesRep,
-		cfg:      &cfg,
+		models: models,
+		repo:   issuesRep,
+		cfg:    &cfg,
+		agg:    agg,
 	}
 }
 
-func (s *Service) Search(ctx context.Context, repo, query string, limit int) ([]Result, error) {
-	emb, err := s.embedder.Embed(ctx, query)
+// Query describes a similarity search within a single repository.
+type Query struct {
+	Repo string
+	// Model is the embedding model of the repo's vectors, empty for the active model.
+	Model string
+	Text  string
+	Limit int
+	Mode  Mode
+	// Filter is applied before the result limit.
+	Filter Filter
+	// Thresholds overrides the configured similarity thresholds when set.
+	Thresholds *Thresholds
+}
+
+// ResolveModel returns the id of the configured model, the active model when id is empty, or ErrUnknownModel.
+func (s *Service) ResolveModel(id string) (string, error) {
+	id, _, err := s.models.Embedder(id)
+	return id, err
+}
+
+// DefaultThresholds returns the configured similarity thresholds.
+func (s *Service) DefaultThresholds() Thresholds {
+	return Thresholds{
+		Strong: s.cfg.StrongSimThr,
+		Weak:   s.cfg.WeakSimThr,
+	}
+}
+
+// hybridCandidates is how many candidates per requested result each leg contributes to rank fusion.
+const hybridCandidates = 3
+
+// Search runs the query in the mode it asks for. When the query text contains a stack trace, issues with the same
+// trace come first, see PromoteStackMatches.
+func (s *Service) Search(ctx context.Context, q Query) ([]Result, error) {
+	results, err := s.search(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	results, err = s.withStackMatches(ctx, q, stacktrace.Fingerprint(q.Text), q.Filter, results)
+	if err != nil {
+		return nil, err
+	}
+	return s.withPullRequests(ctx, results)
+}
+
+func (s *Service) search(ctx context.Context, q Query) ([]Result, error) {
+	if q.Mode == ModeLexical {
+		hits, err := s.repo.SearchByText(ctx, q.Repo, q.Text, nil, q.Limit, q.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("search failed: %w", err)
+		}
+		log.Printf("[search] repo=%s mode=%s q=%q rows=%d", q.Repo, q.Mode, q.Text, len(hits))
+		return RankLexical(hits, q.Limit), nil
+	}
+
+	model, embedder, err := s.models.Embedder(q.Model)
+	if err != nil {
+		return nil, err
+	}
+	vec, err := embedder.Embed(ctx, q.Text)
 	if err != nil {
 		return nil, fmt.Errorf("embedding failed: %w", err)
 	}
+	emb := Embedding{Model: model, Vector: vec}
+
+	if q.Mode == ModeHybrid {
+		candidates := q.Limit * hybridCandidates
+		issues, err := s.repo.SearchByVector(ctx, q.Repo, emb, candidates, q.Filter, s.agg)
+		if err != nil {
+			return nil, fmt.Errorf("search failed: %w", err)
+		}
+		hits, err := s.repo.SearchByText(ctx, q.Repo, q.Text, &emb, candidates, q.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("search failed: %w", err)
+		}
+		log.Printf("[search] repo=%s mode=%s q=%q vector_rows=%d lexical_rows=%d", q.Repo, q.Mode, q.Text, len(issues), len(hits))
+		return FuseRRF(issues, hits, q.Limit, s.thresholds(q)), nil
+	}
 
-	issues, err := s.repo.SearchByVector(ctx, repo, emb, limit)
+	issues, err := s.repo.SearchByVector(ctx, q.Repo, emb, q.Limit, q.Filter, s.agg)
 	if err != nil {
 		return nil, fmt.Errorf("search failed: %w", err)
 	}
-	log.Printf("[search] repo=%s q=%q rows=%d", repo, query, len(issues))
+	log.Printf("[search] repo=%s q=%q rows=%d", q.Repo, q.Text, len(issues))
 
-	thresholds := Thresholds{
-		Strong: s.cfg.StrongSimThr,
-		Weak:   s.cfg.WeakSimThr,
+	return ScoreAndRank(issues, q.Limit, s.thresholds(q)), nil
+}
+
+// GetIssue returns the issue with its linked pull requests.
+func (s *Service) GetIssue(ctx context.Context, id string) (IssueRow, error) {
+	issue, err := s.repo.GetIssue(ctx, id)
+	if err != nil {
+		return issue, err
+	}
+	prs, err := s.repo.LinkedPullRequests(ctx, []string{id})
+	if err != nil {
+		return issue, err
+	}
+	issue.PullRequests = prs[id]
+	return issue, nil
+}
+
+func (s *Service) ListIssues(ctx context.Context, repo string, f Filter, page Page) (IssuePage, error) {
+	return s.repo.ListIssues(ctx, repo, f, page)
+}
+
+// Duplicates finds likely duplicates of the stored issue, as returned by GetIssue, within q.Repo. The stored
+// embedding of the issue is used as query vector, so the embedder is not called; q.Text is ignored. Issues with the
+// same stack trace come first, they are returned even while the issue has no embedding yet. Within each confidence,
+// issues closed as fixed are listed first, see PreferFixed.
+func (s *Service) Duplicates(ctx context.Context, issue IssueRow, q Query) ([]Result, error) {
+	id := issue.ID
+	f := q.Filter
+	f.ExcludeID = id
+
+	var results []Result
+	emb, err := s.repo.GetEmbedding(ctx, id)
+	switch {
+	case errors.Is(err, ErrNoEmbedding) && issue.Fingerprint != "":
+	case err != nil:
+		return nil, err
+	default:
+		issues, err := s.repo.SearchByVector(ctx, q.Repo, emb, q.Limit, f, s.agg)
+		if err != nil {
+			return nil, fmt.Errorf("search failed: %w", err)
+		}
+		log.Printf("[duplicates] repo=%s issue=%s rows=%d", q.Repo, id, len(issues))
+		results = ScoreAndRank(issues, q.Limit, s.thresholds(q))
+	}
+
+	results, err = s.withStackMatches(ctx, q, issue.Fingerprint, f, results)
+	if err != nil {
+		return nil, err
+	}
+	if results == nil {
+		results = []Result{}
+	}
+	return s.withPullRequests(ctx, PreferFixed(results))
+}
+
+// withPullRequests sets the pull requests linked to the results' issues.
+func (s *Service) withPullRequests(ctx context.Context, results []Result) ([]Result, error) {
+	if len(results) == 0 {
+		return results, nil
+	}
+	ids := make([]string, len(results))
+	for i, res := range results {
+		ids[i] = res.ID
+	}
+	prs, err := s.repo.LinkedPullRequests(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+	for i := range results {
+		results[i].PullRequests = prs[results[i].ID]
+	}
+	return results, nil
+}
+
+// withStackMatches promotes the issues of q.Repo with the stack trace fingerprint in results, see
+// PromoteStackMatches.
+func (s *Service) withStackMatches(ctx context.Context, q Query, fingerprint string, f Filter, results []Result) ([]Result, error) {
+	if fingerprint == "" {
+		return results, nil
+	}
+	matches, err := s.repo.SearchByFingerprint(ctx, q.Repo, fingerprint, q.Limit, f)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+	log.Printf("[search] repo=%s fingerprint=%s matches=%d", q.Repo, fingerprint, len(matches))
+	return PromoteStackMatches(results, matches, q.Limit), nil
+}
+
+func (s *Service) thresholds(q Query) Thresholds {
+	if q.Thresholds != nil {
+		return *q.Thresholds
 	}
-	return ScoreAndRank(issues, limit, thresholds), nil
+	return s.DefaultThresholds()
 }
@@ -0,0 +1,268 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/zanmajeric/reporadar-go-ingest/config"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/stacktrace"
+)
+
+// fakeRepo serves issues from memory, SearchByVector returns them in order.
+type fakeRepo struct {
+	embeddings map[string]Embedding
+	issues     []IssueRow
+	excluded   string
+	model      string
+	prs        map[string][]LinkedPR
+}
+
+func (f *fakeRepo) SearchByVector(_ context.Context, _ string, emb Embedding, limit int, filter Filter, _ Aggregation) ([]IssueRow, error) {
+	f.excluded, f.model = filter.ExcludeID, emb.Model
+	var out []IssueRow
+	for _, iss := range f.issues {
+		if iss.ID != filter.ExcludeID && len(out) < limit {
+			out = append(out, iss)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) SearchByText(context.Context, string, string, *Embedding, int, Filter) ([]IssueRow, error) {
+	return nil, nil
+}
+
+func (f *fakeRepo) ListIssues(context.Context, string, Filter, Page) (IssuePage, error) {
+	return IssuePage{Issues: f.issues}, nil
+}
+
+func (f *fakeRepo) GetIssue(_ context.Context, id string) (IssueRow, error) {
+	for _, iss := range f.issues {
+		if iss.ID == id {
+			return iss, nil
+		}
+	}
+	return IssueRow{}, ErrIssueNotFound
+}
+
+func (f *fakeRepo) SearchByFingerprint(_ context.Context, _, fingerprint string, limit int, filter Filter) ([]IssueRow, error) {
+	var out []IssueRow
+	for _, iss := range f.issues {
+		if iss.Fingerprint == fingerprint && iss.ID != filter.ExcludeID && len(out) < limit {
+			out = append(out, iss)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) LinkedPullRequests(_ context.Context, ids []string) (map[string][]LinkedPR, error) {
+	out := map[string][]LinkedPR{}
+	for _, id := range ids {
+		if prs, ok := f.prs[id]; ok {
+			out[id] = prs
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) GetEmbedding(_ context.Context, id string) (Embedding, error) {
+	emb, ok := f.embeddings[id]
+	if !ok {
+		return Embedding{}, ErrNoEmbedding
+	}
+	return emb, nil
+}
+
+// failingEmbedder fails the test when called.
+type failingEmbedder struct{ t *testing.T }
+
+func (f failingEmbedder) Embed(context.Context, string) ([]float32, error) {
+	f.t.Error("embedder must not be called")
+	return nil, errors.New("unexpected call")
+}
+
+func (f failingEmbedder) EmbedBatch(context.Context, []string) ([][]float32, error) {
+	f.t.Error("embedder must not be called")
+	return nil, errors.New("unexpected call")
+}
+
+func TestService_DuplicatesUsesStoredEmbedding(t *testing.T) {
+	repo := &fakeRepo{
+		embeddings: map[string]Embedding{"1": {Model: "old", Vector: []float32{1, 0}}},
+		issues: []IssueRow{
+			{ID: "1", Repo: "demo/reporadar", Distance: -1},
+			{ID: "3", Repo: "demo/reporadar", Distance: -0.8},
+			{ID: "2", Repo: "demo/reporadar", Distance: -0.4},
+		},
+	}
+	srv := New(SingleModel("new", failingEmbedder{t}), repo, config.AppConfig{StrongSimThr: 0.6, WeakSimThr: 0.3})
+
+	got, err := srv.Duplicates(context.Background(), repo.issues[0], Query{Repo: "demo/reporadar", Limit: 10})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.excluded != "1" {
+		t.Errorf("expected the issue itself to be excluded, got %q", repo.excluded)
+	}
+	if repo.model != "old" {
+		t.Errorf("expected vectors of the issue's model to be searched, got %q", repo.model)
+	}
+	if len(got) != 2 || got[0].ID != "3" || got[0].Confidence != ConfidenceStrong || got[1].Confidence != ConfidenceWeak {
+		t.Errorf("unexpected results %+v", got)
+	}
+}
+
+func TestService_DuplicatesListsFixedIssuesFirst(t *testing.T) {
+	repo := &fakeRepo{
+		embeddings: map[string]Embedding{"1": {Model: "m", Vector: []float32{1, 0}}},
+		issues: []IssueRow{
+			{ID: "1", Repo: "demo/reporadar"},
+			{ID: "open", Repo: "demo/reporadar", Distance: -0.9},
+			{ID: "wontfix", Repo: "demo/reporadar", Distance: -0.85, State: "closed", CloseReason: CloseReasonNotPlanned},
+			{ID: "fixed", Repo: "demo/reporadar", Distance: -0.8, State: "closed", CloseReason: CloseReasonCompleted},
+			{ID: "weak", Repo: "demo/reporadar", Distance: -0.4, State: "closed", CloseReason: CloseReasonCompleted},
+		},
+	}
+	srv := New(SingleModel("m", failingEmbedder{t}), repo, config.AppConfig{StrongSimThr: 0.6, WeakSimThr: 0.3})
+
+	got, err := srv.Duplicates(context.Background(), repo.issues[0], Query{Repo: "demo/reporadar", Limit: 10})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ids []string
+	for _, res := range got {
+		ids = append(ids, res.ID)
+	}
+	if !slices.Equal(ids, []string{"fixed", "open", "wontfix", "weak"}) {
+		t.Errorf("expected the strong fixed issue first, got %v", ids)
+	}
+	if !got[0].Fixed || got[0].CloseReason != CloseReasonCompleted || got[1].Fixed || got[2].Fixed {
+		t.Errorf("expected only closed as completed issues to be fixed, got %+v", got)
+	}
+}
+
+func TestService_DuplicatesWithoutEmbedding(t *testing.T) {
+	repo := &fakeRepo{issues: []IssueRow{{ID: "1", Repo: "demo/reporadar"}}}
+	srv := New(SingleModel("m", failingEmbedder{t}), repo, config.AppConfig{})
+
+	_, err := srv.Duplicates(context.Background(), repo.issues[0], Query{Repo: "demo/reporadar", Limit: 10})
+	if !errors.Is(err, ErrNoEmbedding) {
+		t.Errorf("expected ErrNoEmbedding, got %v", err)
+	}
+}
+
+func TestService_DuplicatesMatchesStackTraceWithoutEmbedding(t *testing.T) {
+	repo := &fakeRepo{issues: []IssueRow{
+		{ID: "1", Repo: "demo/reporadar", Fingerprint: "go:abc"},
+		{ID: "2", Repo: "demo/reporadar", Fingerprint: "go:abc"},
+		{ID: "3", Repo: "demo/reporadar", Fingerprint: "go:def"},
+	}}
+	srv := New(SingleModel("m", failingEmbedder{t}), repo, config.AppConfig{})
+
+	got, err := srv.Duplicates(context.Background(), repo.issues[0], Query{Repo: "demo/reporadar", Limit: 10})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != "2" || got[0].Confidence != ConfidenceStrong ||
+		len(got[0].MatchReasons) != 1 || got[0].MatchReasons[0] != MatchStackTrace {
+		t.Errorf("expected issue 2 as a stack trace match, got %+v", got)
+	}
+}
+
+func TestService_SearchPromotesIssuesWithSameStackTrace(t *testing.T) {
+	trace := "panic: boom\n\ngoroutine 1 [running]:\nmain.handle(0x0)\n\t/app/main.go:42 +0x1d\nmain.main()\n\t/app/main.go:10 +0x25"
+	repo := &fakeRepo{issues: []IssueRow{
+		{ID: "similar", Repo: "demo/reporadar", Distance: -0.9},
+		{ID: "crash", Repo: "demo/reporadar", Distance: -0.1, Fingerprint: stacktrace.Fingerprint(trace)},
+	}}
+	srv := New(SingleModel("m", constEmbedder{1, 0}), repo, config.AppConfig{StrongSimThr: 0.6, WeakSimThr: 0.3})
+
+	got, err := srv.Search(context.Background(), Query{Repo: "demo/reporadar", Text: "App crashes:\n" + trace, Limit: 5})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0].ID != "crash" || got[1].ID != "similar" {
+		t.Fatalf("expected the stack trace match first, got %+v", got)
+	}
+	if got[0].Confidence != ConfidenceStrong || len(got[0].MatchReasons) != 1 || got[0].MatchReasons[0] != MatchStackTrace {
+		t.Errorf("expected a strong stack trace match, got %+v", got[0])
+	}
+}
+
+func TestService_SearchReturnsMatchingComment(t *testing.T) {
+	comment := &CommentMatch{ID: "c1", Author: "octocat"}
+	repo := &fakeRepo{issues: []IssueRow{
+		{ID: "1", Repo: "demo/reporadar", Distance: -0.9, Snippet: "Same here after updating", Comment: comment},
+		{ID: "2", Repo: "demo/reporadar", Distance: -0.8, Snippet: "Crash on login"},
+	}}
+	srv := New(SingleModel("m", constEmbedder{1, 0}), repo, config.AppConfig{StrongSimThr: 0.6, WeakSimThr: 0.3})
+
+	got, err := srv.Search(context.Background(), Query{Repo: "demo/reporadar", Text: "crash after update", Limit: 5})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0].Comment != comment || got[0].Snippet != "Same here after updating" || got[1].Comment != nil {
+		t.Errorf("expected the parent issue with the matching comment, got %+v", got)
+	}
+}
+
+func TestService_ResultsCarryLinkedPullRequests(t *testing.T) {
+	fix := LinkedPR{Number: 7, Title: "Fix login crash", State: "open"}
+	repo := &fakeRepo{
+		issues: []IssueRow{{ID: "1", Repo: "demo/reporadar", Distance: -0.9}, {ID: "2", Repo: "demo/reporadar", Distance: -0.8}},
+		prs:    map[string][]LinkedPR{"1": {fix}},
+	}
+	srv := New(SingleModel("m", constEmbedder{1, 0}), repo, config.AppConfig{StrongSimThr: 0.6, WeakSimThr: 0.3})
+
+	got, err := srv.Search(context.Background(), Query{Repo: "demo/reporadar", Text: "login crash", Limit: 5})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || len(got[0].PullRequests) != 1 || got[0].PullRequests[0] != fix || got[1].PullRequests != nil {
+		t.Errorf("expected the pull request on issue 1 only, got %+v", got)
+	}
+
+	issue, err := srv.GetIssue(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(issue.PullRequests) != 1 || issue.PullRequests[0] != fix {
+		t.Errorf("expected the issue with its pull request, got %+v", issue)
+	}
+}
+
+// constEmbedder embeds every text into the same vector.
+type constEmbedder []float32
+
+func (e constEmbedder) Embed(context.Context, string) ([]float32, error) { return e, nil }
+
+func (e constEmbedder) EmbedBatch(_ context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i := range out {
+		out[i] = e
+	}
+	return out, nil
+}
+
+func TestService_SearchUsesModelOfRepo(t *testing.T) {
+	repo := &fakeRepo{}
+	models := Models{Active: "new", Embedders: map[string]Embedder{
+		"new": failingEmbedder{t},
+		"old": constEmbedder{1, 0},
+	}}
+	srv := New(models, repo, config.AppConfig{})
+
+	if _, err := srv.Search(context.Background(), Query{Repo: "demo/reporadar", Model: "old", Text: "crash", Limit: 5}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.model != "old" {
+		t.Errorf("expected vectors of the repo's model to be searched, got %q", repo.model)
+	}
+
+	_, err := srv.Search(context.Background(), Query{Repo: "demo/reporadar", Model: "gone", Text: "crash", Limit: 5})
+	if !errors.Is(err, ErrUnknownModel) {
+		t.Errorf("expected ErrUnknownModel, got %v", err)
+	}
+}
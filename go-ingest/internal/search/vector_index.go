@@ -0,0 +1,59 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// nearestChunksPerHit is how many chunks SearchByVector considers per requested hit and aggregated chunk, the
+	// approximate nearest neighbours its scores are computed from.
+	nearestChunksPerHit = 8
+	// maxEfSearch is the largest hnsw.ef_search pgvector accepts.
+	maxEfSearch = 1000
+)
+
+// EnsureVectorIndex creates the HNSW index serving vector searches of model unless it exists. HNSW indexes need a
+// fixed dimension while issue_chunks.embedding holds vectors of any, so the index is built on the embeddings cast to
+// dim and restricted to the chunks of the model; SearchByVector queries the same expression. Building the index of a
+// populated table takes a while and blocks writes to it, so it runs at startup.
+func (pgr *PgRepository) EnsureVectorIndex(ctx context.Context, model string, dim int) error {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s/%d", model, dim)
+	name := fmt.Sprintf("idx_issue_chunks_hnsw_%08x", h.Sum32())
+
+	start := time.Now()
+	_, err := pgr.db.Exec(ctx, fmt.Sprintf(
+		`CREATE INDEX IF NOT EXISTS %s ON issue_chunks USING hnsw ((embedding::vector(%d)) vector_ip_ops) WHERE model = '%s'`,
+		name, dim, strings.ReplaceAll(model, "'", "''"),
+	))
+	if err != nil {
+		return fmt.Errorf("vector index of model %q: %w", model, err)
+	}
+	log.Printf("[search] vector index %s of model=%s dim=%d ready in %v", name, model, dim, time.Since(start))
+
+	// Iterative index scans (pgvector 0.8) keep scanning the index until enough chunks passed the repo and filter
+	// conditions, instead of returning fewer hits than asked for.
+	var version string
+	if err := pgr.db.QueryRow(ctx, `SELECT extversion FROM pg_extension WHERE extname = 'vector'`).Scan(&version); err != nil {
+		return fmt.Errorf("pgvector version: %w", err)
+	}
+	var major, minor int
+	fmt.Sscanf(version, "%d.%d", &major, &minor)
+	pgr.iterativeScan = major > 0 || minor >= 8
+	return nil
+}
+
+// nearestChunks is the number of nearest chunks SearchByVector aggregates into limit hits. Without iterative scans an
+// HNSW index scan returns at most hnsw.ef_search rows, so it is capped at maxEfSearch then.
+func nearestChunks(limit int, agg Aggregation, iterativeScan bool) int {
+	n := max(limit*max(agg.TopK, 1)*nearestChunksPerHit, 100)
+	if !iterativeScan {
+		n = min(n, maxEfSearch)
+	}
+	return n
+}
@@ -0,0 +1,25 @@
+package search
+
+import "testing"
+
+func TestNearestChunks(t *testing.T) {
+	cases := []struct {
+		name      string
+		limit     int
+		agg       Aggregation
+		iterative bool
+		want      int
+	}{
+		{name: "at least 100", limit: 5, agg: Aggregation{TopK: 1}, want: 100},
+		{name: "per hit and chunk", limit: 10, agg: Aggregation{TopK: 3}, want: 240},
+		{name: "capped at the largest ef_search", limit: 50, agg: Aggregation{TopK: 3}, want: maxEfSearch},
+		{name: "not capped with iterative scans", limit: 50, agg: Aggregation{TopK: 3}, iterative: true, want: 1200},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := nearestChunks(tc.limit, tc.agg, tc.iterative); got != tc.want {
+				t.Errorf("expected %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
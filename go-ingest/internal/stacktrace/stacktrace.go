@@ -0,0 +1,131 @@
+// Package stacktrace finds stack traces in issue bodies and reduces them to a fingerprint of their top frames, so
+// reports of the same crash match whatever words they are described with.
+package stacktrace
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	LangGo         = "go"
+	LangJava       = "java"
+	LangPython     = "python"
+	LangJavaScript = "js"
+)
+
+// Frames is how many of the innermost frames make up a fingerprint. Deeper frames are mostly framework and main loop
+// code shared by unrelated crashes.
+const Frames = 5
+
+// minFrames is the least number of frames a trace needs to be fingerprinted, a single frame matches too much.
+const minFrames = 2
+
+var (
+	// main.(*Server).handle(0xc000010000, {0x0, 0x0})
+	goFuncRe = regexp.MustCompile(`^(\S+\.\S+)\([^()]*\)$`)
+	// 	/home/u/app/server.go:42 +0x1d
+	goFileRe = regexp.MustCompile(`^\s+\S+\.go:\d+`)
+	// 	at com.example.Server.handle(Server.java:42)
+	javaRe = regexp.MustCompile(`^\s*at\s+(?:[\w.\-]+/)?([\w$.<>/]+)\((?:[^():]*(?::\d+)?)\)\s*$`)
+	//   File "/app/server.py", line 42, in handle
+	pythonRe = regexp.MustCompile(`^\s*File "([^"]+)", line \d+, in (\S+)`)
+	//     at Server.handle (/app/server.js:42:7) or at /app/server.js:42:7
+	jsRe = regexp.MustCompile(`^\s*at\s+(?:(?:async\s+)?(.+?)\s+\()?(\S+?):\d+:\d+\)?\s*$`)
+
+	javaLambdaRe = regexp.MustCompile(`\$\$Lambda\$\d+/(0x)?[0-9a-f]+`)
+	goTypeArgsRe = regexp.MustCompile(`\[[^\]]*\]`)
+)
+
+// Trace is a stack trace reduced to normalized frames, innermost first.
+type Trace struct {
+	Lang   string
+	Frames []string
+}
+
+// Fingerprint identifies the trace by its language and innermost frames.
+func (t Trace) Fingerprint() string {
+	frames := t.Frames[:min(len(t.Frames), Frames)]
+	sum := sha1.Sum([]byte(strings.Join(frames, "\n")))
+	return t.Lang + ":" + hex.EncodeToString(sum[:8])
+}
+
+// Fingerprint returns the fingerprint of the first stack trace in text, or "" when there is none.
+func Fingerprint(text string) string {
+	t, ok := Detect(text)
+	if !ok {
+		return ""
+	}
+	return t.Fingerprint()
+}
+
+// Detect finds the first stack trace in text, recognizing Go panics and Java, Python and JavaScript (Node.js and
+// browser) traces. Frames are reduced to function names, without arguments, line numbers, addresses or directories,
+// and frames of the language runtime are dropped. Chained traces of the same language ("Caused by", "During handling
+// of the above exception") are read as one.
+func Detect(text string) (Trace, bool) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var t Trace
+	for i := range lines {
+		lang, frame, ok := parseFrame(lines, i)
+		if !ok || (t.Lang != "" && lang != t.Lang) {
+			continue
+		}
+		t.Lang = lang
+		if frame != "" {
+			t.Frames = append(t.Frames, frame)
+		}
+	}
+	if t.Lang == LangPython {
+		// Python prints the innermost frame last.
+		for i, j := 0, len(t.Frames)-1; i < j; i, j = i+1, j-1 {
+			t.Frames[i], t.Frames[j] = t.Frames[j], t.Frames[i]
+		}
+	}
+	if len(t.Frames) < minFrames {
+		return Trace{}, false
+	}
+	return t, true
+}
+
+// parseFrame parses line i as a frame. A frame of the runtime is recognized with an empty name.
+func parseFrame(lines []string, i int) (lang, frame string, ok bool) {
+	line := lines[i]
+	if m := pythonRe.FindStringSubmatch(line); m != nil {
+		file := m[1]
+		if strings.HasPrefix(file, "<frozen ") {
+			return LangPython, "", true
+		}
+		return LangPython, path.Base(strings.ReplaceAll(file, `\`, "/")) + ":" + m[2], true
+	}
+	if m := jsRe.FindStringSubmatch(line); m != nil {
+		fn, file := m[1], m[2]
+		if strings.HasPrefix(file, "node:") || strings.HasPrefix(file, "internal/") {
+			return LangJavaScript, "", true
+		}
+		if fn == "" || fn == "<anonymous>" {
+			return LangJavaScript, path.Base(file), true
+		}
+		return LangJavaScript, strings.TrimPrefix(fn, "new "), true
+	}
+	if m := javaRe.FindStringSubmatch(line); m != nil {
+		fn := javaLambdaRe.ReplaceAllString(m[1], "$$$$Lambda")
+		for _, prefix := range []string{"java.", "javax.", "jdk.", "sun."} {
+			if strings.HasPrefix(fn, prefix) {
+				return LangJava, "", true
+			}
+		}
+		return LangJava, fn, true
+	}
+	if m := goFuncRe.FindStringSubmatch(line); m != nil && i+1 < len(lines) && goFileRe.MatchString(lines[i+1]) {
+		fn := goTypeArgsRe.ReplaceAllString(m[1], "[...]")
+		if strings.HasPrefix(fn, "runtime.") || strings.HasPrefix(fn, "panic") {
+			return LangGo, "", true
+		}
+		return LangGo, fn, true
+	}
+	return "", "", false
+}
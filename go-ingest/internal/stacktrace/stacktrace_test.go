@@ -0,0 +1,105 @@
+package stacktrace
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		text   string
+		lang   string
+		frames []string
+	}{
+		{
+			name: "go panic",
+			text: `panic: runtime error: invalid memory address or nil pointer dereference
+[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x4a2b3c]
+
+goroutine 1 [running]:
+panic({0x4c1e20?, 0x5d3b10?})
+	/usr/local/go/src/runtime/panic.go:770 +0x132
+main.(*Server).handle(0x0, {0xc00001c030, 0x5})
+	/home/u/app/server.go:42 +0x1d
+main.Map[...](0xc000010000)
+	/home/u/app/util.go:7 +0x25
+main.main()
+	/home/u/app/main.go:10 +0x25
+exit status 2`,
+			lang:   LangGo,
+			frames: []string{"main.(*Server).handle", "main.Map[...]", "main.main"},
+		},
+		{
+			name: "java",
+			text: `Exception in thread "main" java.lang.NullPointerException
+	at java.base/java.util.Objects.requireNonNull(Objects.java:233)
+	at com.example.Server.handle(Server.java:42)
+	at com.example.Server$$Lambda$14/0x0000000800c03000.run(Unknown Source)
+	at com.example.Main.main(Main.java:10)`,
+			lang:   LangJava,
+			frames: []string{"com.example.Server.handle", "com.example.Server$$Lambda.run", "com.example.Main.main"},
+		},
+		{
+			name: "python",
+			text: `Traceback (most recent call last):
+  File "/usr/lib/python3.12/site-packages/app/main.py", line 10, in <module>
+    run()
+  File "/usr/lib/python3.12/site-packages/app/server.py", line 42, in handle
+    return cfg["port"]
+KeyError: 'port'`,
+			lang:   LangPython,
+			frames: []string{"server.py:handle", "main.py:<module>"},
+		},
+		{
+			name: "node",
+			text: `TypeError: Cannot read properties of undefined (reading 'id')
+    at Server.handle (/app/src/server.js:42:7)
+    at async Promise.all (index 0)
+    at /app/src/main.js:10:3
+    at node:internal/process/task_queues:95:5`,
+			lang:   LangJavaScript,
+			frames: []string{"Server.handle", "main.js"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			trace, ok := Detect("Steps to reproduce: start the app.\n\n```\n" + tc.text + "\n```")
+			if !ok {
+				t.Fatal("expected a trace")
+			}
+			if trace.Lang != tc.lang || !reflect.DeepEqual(trace.Frames, tc.frames) {
+				t.Errorf("expected %s %q, got %s %q", tc.lang, tc.frames, trace.Lang, trace.Frames)
+			}
+		})
+	}
+}
+
+func TestFingerprint_IgnoresAddressesLinesAndPaths(t *testing.T) {
+	a := "goroutine 1 [running]:\nmain.(*Server).handle(0x0)\n\t/home/alice/app/server.go:42 +0x1d\nmain.main()\n\t/home/alice/app/main.go:10 +0x25"
+	b := "It crashed again:\ngoroutine 7 [running]:\nmain.(*Server).handle(0xc000123456)\n\t/build/app/server.go:45 +0x2f\nmain.main()\n\t/build/app/main.go:12 +0x31"
+	c := strings.ReplaceAll(a, "main.main", "main.run")
+
+	fa, fb, fc := Fingerprint(a), Fingerprint(b), Fingerprint(c)
+	if fa == "" || !strings.HasPrefix(fa, "go:") {
+		t.Fatalf("expected a go fingerprint, got %q", fa)
+	}
+	if fa != fb {
+		t.Errorf("expected the same crash to match, got %q and %q", fa, fb)
+	}
+	if fa == fc {
+		t.Errorf("expected different frames to differ")
+	}
+}
+
+func TestFingerprint_NeedsTwoFrames(t *testing.T) {
+	for _, text := range []string{
+		"The button does nothing, see https://example.com:443/x",
+		"    at Server.handle (/app/src/server.js:42:7)",
+		"Call f(x) and then\n  g.go:1",
+	} {
+		if fp := Fingerprint(text); fp != "" {
+			t.Errorf("expected no fingerprint for %q, got %q", text, fp)
+		}
+	}
+}
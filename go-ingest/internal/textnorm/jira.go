@@ -0,0 +1,123 @@
+package textnorm
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// {code}, {code:java}, {code:title=Foo.java|borderStyle=solid} and {noformat}
+	jiraCodeRe    = regexp.MustCompile(`^\{(code|noformat)(?::[^}]*)?\}`)
+	jiraHeadingRe = regexp.MustCompile(`^h[1-6]\.\s+`)
+	jiraListRe    = regexp.MustCompile(`^[*#-]+\s+`)
+	// {quote}, {panel:title=Foo}, {color:red} and their closing tags
+	jiraBlockTagRe = regexp.MustCompile(`\{(?:quote|panel|color)(?::[^}]*)?\}`)
+	jiraImageRe    = regexp.MustCompile(`![^!\s][^!\n]*!`)
+	jiraLinkRe     = regexp.MustCompile(`\[([^|\]\n]+)\|[^\]\n]+\]`)
+	jiraBareLinkRe = regexp.MustCompile(`\[((?:https?://|mailto:)[^\]\n]+)\]`)
+	jiraMentionRe  = regexp.MustCompile(`\[~(?:accountid:)?([^\]\n]+)\]`)
+	jiraMonoRe     = regexp.MustCompile(`\{\{(.+?)\}\}`)
+	jiraCiteRe     = regexp.MustCompile(`\?\?(.+?)\?\?`)
+	// *bold*, _italic_, +underline+ and -strikethrough- around words, not the * of a list or the - of "a - b"
+	jiraEffectRe = regexp.MustCompile(`(^|[\s(\[])([*_+-])(\S|\S[^\n]*?\S)([*_+-])($|[\s).,:;!?\]])`)
+)
+
+// FormatJiraWiki is the body format of issues written in Jira wiki markup.
+const FormatJiraWiki = "jira_wiki"
+
+// PlainText converts a body of the given format to plain text, see JiraWikiToText. Bodies without a format are
+// markdown and returned as they are.
+func PlainText(body, format string) string {
+	if format == FormatJiraWiki {
+		return JiraWikiToText(body)
+	}
+	return body
+}
+
+// JiraWikiToText converts Jira wiki markup to plain text. Headings, list bullets, text effects, links, mentions,
+// images and table separators are stripped; {code} and {noformat} blocks become ``` fenced blocks with their content
+// untouched, so they are still recognized as code by chunking, text normalization and stack trace detection.
+func JiraWikiToText(markup string) string {
+	var (
+		out    []string
+		inCode bool
+	)
+	for _, line := range strings.Split(strings.ReplaceAll(markup, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if m := jiraCodeRe.FindStringSubmatch(trimmed); m != nil && !inCode {
+			out = append(out, "```")
+			rest := strings.TrimSpace(trimmed[len(m[0]):])
+			// The block may close on the same line: {code}x = 1{code}
+			if inner, ok := strings.CutSuffix(rest, "{"+m[1]+"}"); ok {
+				out = append(out, inner, "```")
+				continue
+			}
+			if rest != "" {
+				out = append(out, rest)
+			}
+			inCode = true
+			continue
+		}
+		if inCode {
+			if before, ok := cutCodeEnd(line); ok {
+				if strings.TrimSpace(before) != "" {
+					out = append(out, before)
+				}
+				out = append(out, "```")
+				inCode = false
+				continue
+			}
+			out = append(out, line)
+			continue
+		}
+		out = append(out, jiraLineToText(trimmed))
+	}
+	if inCode {
+		out = append(out, "```")
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// cutCodeEnd returns the part of a line of a code block before its closing tag.
+func cutCodeEnd(line string) (string, bool) {
+	for _, tag := range []string{"{code}", "{noformat}"} {
+		if before, _, ok := strings.Cut(line, tag); ok {
+			return before, true
+		}
+	}
+	return "", false
+}
+
+func jiraLineToText(line string) string {
+	line = jiraHeadingRe.ReplaceAllString(line, "")
+	if strings.HasPrefix(line, "|") {
+		// ||heading||heading|| and |cell|cell|
+		cells := strings.FieldsFunc(line, func(r rune) bool { return r == '|' })
+		for i := range cells {
+			cells[i] = strings.TrimSpace(cells[i])
+		}
+		line = strings.Join(cells, " | ")
+	}
+	if loc := jiraListRe.FindStringIndex(line); loc != nil {
+		line = "- " + line[loc[1]:]
+	}
+	line = strings.ReplaceAll(line, `\\`, "\n")
+	line = jiraBlockTagRe.ReplaceAllString(line, "")
+	line = jiraImageRe.ReplaceAllString(line, "")
+	line = jiraMentionRe.ReplaceAllString(line, "@$1")
+	line = jiraLinkRe.ReplaceAllString(line, "$1")
+	line = jiraBareLinkRe.ReplaceAllString(line, "$1")
+	line = jiraMonoRe.ReplaceAllString(line, "$1")
+	line = jiraCiteRe.ReplaceAllString(line, "$1")
+	// Effects may nest, e.g. *_important_*
+	for i := 0; i < 2; i++ {
+		line = jiraEffectRe.ReplaceAllStringFunc(line, func(m string) string {
+			sub := jiraEffectRe.FindStringSubmatch(m)
+			if sub[2] != sub[4] {
+				return m
+			}
+			return sub[1] + sub[3] + sub[5]
+		})
+	}
+	return strings.TrimSpace(line)
+}
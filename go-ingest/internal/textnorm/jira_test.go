@@ -0,0 +1,29 @@
+package textnorm
+
+import "testing"
+
+func TestJiraWikiToText(t *testing.T) {
+	cases := []struct {
+		name, in, want string
+	}{
+		{"heading", "h1. Crash on start", "Crash on start"},
+		{"effects", "it is *really* _very_ {{slow}} -not- +fast+", "it is really very slow not fast"},
+		{"nested effects", "*_important_*", "important"},
+		{"lists", "* one\n** two\n# three", "- one\n- two\n- three"},
+		{"links", "see [the docs|https://example.com/docs] or [https://example.com]", "see the docs or https://example.com"},
+		{"mention", "ping [~alice] and [~accountid:5b10ac]", "ping @alice and @5b10ac"},
+		{"image", "screenshot: !crash.png|thumbnail!", "screenshot:"},
+		{"table", "||Version||OS||\n|2.1|Linux|", "Version | OS\n2.1 | Linux"},
+		{"quote", "{quote}it broke{quote}", "it broke"},
+		{"code", "Trace:\n{code:java}\nat *Foo*.bar(Foo.java:1)\n{code}\ndone", "Trace:\n```\nat *Foo*.bar(Foo.java:1)\n```\ndone"},
+		{"noformat one line", "{noformat}x = _1_{noformat}", "```\nx = _1_\n```"},
+		{"plain", "a - b, snake_case_name and 2024-11-01", "a - b, snake_case_name and 2024-11-01"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := JiraWikiToText(tc.in); got != tc.want {
+				t.Errorf("JiraWikiToText(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
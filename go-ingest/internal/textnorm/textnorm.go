@@ -0,0 +1,301 @@
+// Package textnorm cleans issue bodies up before they are embedded, so the vectors are about what the reporter wrote
+// rather than issue template boilerplate, links and pages of log output.
+package textnorm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Steps of the pipeline, applied in this order whatever order they are configured in.
+const (
+	// StepStripComments removes HTML comments, e.g. the instructions of issue templates.
+	StepStripComments = "strip_comments"
+	// StepStripBoilerplate removes checklists, "_No response_" placeholders, <details> tags, headings of empty
+	// sections and lines matching Options.Boilerplate.
+	StepStripBoilerplate = "strip_boilerplate"
+	// StepDropImages removes markdown and HTML images.
+	StepDropImages = "drop_images"
+	// StepDropURLs replaces markdown links by their text and removes bare URLs.
+	StepDropURLs = "drop_urls"
+	// StepCollapseCode removes blank lines and fence info strings from code blocks and folds runs of identical lines.
+	StepCollapseCode = "collapse_code"
+	// StepTruncateLogs keeps the first Options.LogHead and last Options.LogTail lines of long code blocks.
+	StepTruncateLogs = "truncate_logs"
+)
+
+// AllSteps is the default pipeline.
+var AllSteps = []string{StepStripComments, StepStripBoilerplate, StepDropImages, StepDropURLs, StepCollapseCode, StepTruncateLogs}
+
+// Default number of lines kept at the start and the end of a truncated code block.
+const (
+	DefaultLogHead = 20
+	DefaultLogTail = 30
+)
+
+type Options struct {
+	// Steps to apply, AllSteps when empty.
+	Steps []string
+	// Boilerplate are regular expressions of further lines to remove, matched against the trimmed line.
+	Boilerplate []string
+	LogHead     int
+	LogTail     int
+}
+
+var (
+	commentRe    = regexp.MustCompile(`(?s)<!--.*?-->`)
+	checklistRe  = regexp.MustCompile(`^[-*+]\s+\[[ xX]\]\s`)
+	noResponseRe = regexp.MustCompile(`^_?No response_?$`)
+	detailsTagRe = regexp.MustCompile(`(?i)</?(details|summary)>`)
+	headingRe    = regexp.MustCompile(`^(#{1,6}\s+\S.*|\*\*[^*]+\*\*:?)$`)
+	mdImageRe    = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	htmlImageRe  = regexp.MustCompile(`(?i)<img\b[^>]*>`)
+	mdLinkRe     = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	bareURLRe    = regexp.MustCompile(`<?\bhttps?://[^\s)>]*[^\s)>.,;:!?'"]>?`)
+	innerSpaceRe = regexp.MustCompile(`(\S)[ \t]{2,}`)
+	blankLinesRe = regexp.MustCompile(`\n{3,}`)
+	trailingWSRe = regexp.MustCompile(`[ \t]+\n`)
+	fenceInfoRe  = regexp.MustCompile("^(```|~~~)")
+	emptyLinkRe  = regexp.MustCompile(`\[\]\([^)]*\)`)
+)
+
+// Pipeline normalizes texts with the configured steps. A nil Pipeline leaves texts unchanged.
+type Pipeline struct {
+	steps       map[string]bool
+	boilerplate []*regexp.Regexp
+	logHead     int
+	logTail     int
+}
+
+func New(opts Options) (*Pipeline, error) {
+	p := &Pipeline{steps: map[string]bool{}, logHead: opts.LogHead, logTail: opts.LogTail}
+	steps := opts.Steps
+	if len(steps) == 0 {
+		steps = AllSteps
+	}
+	for _, step := range steps {
+		if !isStep(step) {
+			return nil, fmt.Errorf("unknown text normalization step %q", step)
+		}
+		p.steps[step] = true
+	}
+	for _, expr := range opts.Boilerplate {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boilerplate pattern %q: %w", expr, err)
+		}
+		p.boilerplate = append(p.boilerplate, re)
+	}
+	if p.logHead <= 0 {
+		p.logHead = DefaultLogHead
+	}
+	if p.logTail <= 0 {
+		p.logTail = DefaultLogTail
+	}
+	return p, nil
+}
+
+func isStep(step string) bool {
+	for _, s := range AllSteps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize returns the text with the pipeline's steps applied. Fenced code blocks stay fenced, so they can still be
+// told apart from the prose around them.
+func (p *Pipeline) Normalize(text string) string {
+	if p == nil {
+		return text
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if p.steps[StepStripComments] {
+		text = commentRe.ReplaceAllString(text, "")
+	}
+
+	var out []string
+	for _, b := range SplitBlocks(text) {
+		if b.Code {
+			out = append(out, p.code(b))
+			continue
+		}
+		out = append(out, p.prose(b.Text()))
+	}
+	text = strings.Join(out, "\n")
+	if p.steps[StepStripBoilerplate] {
+		text = dropEmptySections(text)
+	}
+	text = trailingWSRe.ReplaceAllString(text, "\n")
+	return strings.TrimSpace(blankLinesRe.ReplaceAllString(text, "\n\n"))
+}
+
+func (p *Pipeline) prose(text string) string {
+	if p.steps[StepDropImages] {
+		text = mdImageRe.ReplaceAllString(text, "")
+		text = htmlImageRe.ReplaceAllString(text, "")
+	}
+	if p.steps[StepDropURLs] {
+		text = mdLinkRe.ReplaceAllString(text, "$1")
+		text = bareURLRe.ReplaceAllString(text, "")
+		// What is left of links whose text was a URL
+		text = emptyLinkRe.ReplaceAllString(text, "")
+	}
+	if p.steps[StepDropImages] || p.steps[StepDropURLs] {
+		text = innerSpaceRe.ReplaceAllString(text, "$1 ")
+	}
+	if !p.steps[StepStripBoilerplate] {
+		return text
+	}
+	text = detailsTagRe.ReplaceAllString(text, "")
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !p.isBoilerplate(strings.TrimSpace(line)) {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+func (p *Pipeline) isBoilerplate(line string) bool {
+	if checklistRe.MatchString(line) || noResponseRe.MatchString(line) {
+		return true
+	}
+	for _, re := range p.boilerplate {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Pipeline) code(b Block) string {
+	lines := b.Lines
+	fence := b.Fence
+	if p.steps[StepCollapseCode] {
+		fence = fenceInfoRe.FindString(fence)
+		lines = collapseLines(lines)
+		if len(lines) == 0 {
+			return ""
+		}
+	}
+	if p.steps[StepTruncateLogs] && len(lines) > p.logHead+p.logTail+1 {
+		omitted := len(lines) - p.logHead - p.logTail
+		truncated := append([]string{}, lines[:p.logHead]...)
+		truncated = append(truncated, fmt.Sprintf("[... %d lines omitted ...]", omitted))
+		lines = append(truncated, lines[len(lines)-p.logTail:]...)
+	}
+	closing := fenceInfoRe.FindString(b.Fence)
+	return fence + "\n" + strings.Join(lines, "\n") + "\n" + closing
+}
+
+// collapseLines drops blank lines and folds runs of identical lines, e.g. repeated stack frames or retry messages,
+// into one.
+func collapseLines(lines []string) []string {
+	var out []string
+	for i := 0; i < len(lines); {
+		j := i + 1
+		for j < len(lines) && lines[j] == lines[i] {
+			j++
+		}
+		switch {
+		case strings.TrimSpace(lines[i]) == "":
+		case j-i > 1:
+			out = append(out, fmt.Sprintf("%s [repeated %d times]", lines[i], j-i))
+		default:
+			out = append(out, lines[i])
+		}
+		i = j
+	}
+	return out
+}
+
+// dropEmptySections removes headings of sections without any content, as left by template sections the reporter did
+// not fill in. A section runs until the next heading of the same or a higher level.
+func dropEmptySections(text string) string {
+	lines := strings.Split(text, "\n")
+	// Heading levels by line, 0 for content and -1 for blank lines. Bold lines rank below all markdown headings.
+	levels := make([]int, len(lines))
+	inCode := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fenceInfoRe.MatchString(trimmed):
+			inCode = !inCode
+		case inCode:
+		case trimmed == "":
+			levels[i] = -1
+		case headingRe.MatchString(trimmed):
+			levels[i] = strings.IndexFunc(trimmed, func(r rune) bool { return r != '#' })
+			if levels[i] == 0 {
+				levels[i] = 7
+			}
+		}
+	}
+
+	kept := lines[:0]
+	for i, line := range lines {
+		if levels[i] <= 0 || hasContent(levels, i) {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// hasContent reports whether the section of the heading at i has a content line.
+func hasContent(levels []int, i int) bool {
+	for _, level := range levels[i+1:] {
+		switch {
+		case level == 0:
+			return true
+		case level > 0 && level <= levels[i]:
+			return false
+		}
+	}
+	return false
+}
+
+// Block is a fenced code block or the prose around code blocks, see SplitBlocks.
+type Block struct {
+	Code bool
+	// Fence is the opening fence of a code block with its info string, e.g. ```go.
+	Fence string
+	// Lines are the lines of the block, without the fences of a code block.
+	Lines []string
+}
+
+// Text returns the lines of the block.
+func (b Block) Text() string {
+	return strings.Join(b.Lines, "\n")
+}
+
+// SplitBlocks separates fenced code blocks (``` or ~~~, with an optional info string) from the prose around them. A
+// block is closed by a line of only its fence characters, an unclosed one runs to the end of the text. Chunking and
+// normalization both split bodies with it, so they agree on what is code.
+func SplitBlocks(text string) []Block {
+	var (
+		blocks []Block
+		lines  []string
+		fence  string
+	)
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence == "" && fenceInfoRe.MatchString(trimmed):
+			blocks = append(blocks, Block{Lines: lines})
+			lines, fence = nil, trimmed
+		case fence != "" && strings.HasPrefix(trimmed, fence[:3]) && strings.Trim(trimmed, fence[:1]) == "":
+			blocks = append(blocks, Block{Code: true, Fence: fence, Lines: lines})
+			lines, fence = nil, ""
+		default:
+			lines = append(lines, line)
+		}
+	}
+	if fence != "" {
+		return append(blocks, Block{Code: true, Fence: fence, Lines: lines})
+	}
+	return append(blocks, Block{Lines: lines})
+}
@@ -0,0 +1,132 @@
+package textnorm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newPipeline(t *testing.T, opts Options) *Pipeline {
+	t.Helper()
+	p, err := New(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return p
+}
+
+func TestPipeline_StripsTemplateBoilerplate(t *testing.T) {
+	body := `<!-- Thanks for reporting! Please fill in the sections below. -->
+### Describe the bug
+
+App crashes on login.
+
+### Screenshots
+
+<!--
+If applicable, add screenshots.
+-->
+
+### Checklist
+
+- [x] I searched existing issues
+- [ ] I read the docs
+
+**Environment**
+_No response_
+
+Sent from my phone`
+	p := newPipeline(t, Options{Boilerplate: []string{`^Sent from my`}})
+
+	want := "### Describe the bug\n\nApp crashes on login."
+	if got := p.Normalize(body); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestPipeline_DropsImagesAndURLs(t *testing.T) {
+	body := "See ![screenshot](https://example.com/a.png) <img src=\"b.png\" width=\"200\">and the [docs](https://example.com/docs),\n" +
+		"logs at https://gist.github.com/x/y or [https://example.com](https://example.com)."
+	p := newPipeline(t, Options{})
+
+	want := "See and the docs,\nlogs at or ."
+	if got := p.Normalize(body); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestPipeline_CollapsesAndTruncatesCodeBlocks(t *testing.T) {
+	var log []string
+	for i := 1; i <= 10; i++ {
+		log = append(log, fmt.Sprintf("line %d", i))
+	}
+	body := "Trace:\n```go\nretrying\nretrying\nretrying\n\n" + strings.Join(log, "\n") + "\n```\nhttps://kept-outside.example"
+	p := newPipeline(t, Options{Steps: []string{StepCollapseCode, StepTruncateLogs}, LogHead: 2, LogTail: 3})
+
+	want := "Trace:\n```\nretrying [repeated 3 times]\nline 1\n[... 6 lines omitted ...]\nline 8\nline 9\nline 10\n```\n" +
+		"https://kept-outside.example"
+	if got := p.Normalize(body); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestPipeline_LeavesCodeOfEmptySectionsAlone(t *testing.T) {
+	body := "## Logs\n```\n# not a heading\n```\n## Expected\n"
+	p := newPipeline(t, Options{Steps: []string{StepStripBoilerplate}})
+
+	want := "## Logs\n```\n# not a heading\n```"
+	if got := p.Normalize(body); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSplitBlocks(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		text string
+		want []Block
+	}{
+		{
+			name: "info string",
+			text: "Steps\n```go\nx := 1\n```\nDone",
+			want: []Block{{Lines: []string{"Steps"}}, {Code: true, Fence: "```go", Lines: []string{"x := 1"}},
+				{Lines: []string{"Done"}}},
+		},
+		{
+			name: "only the same fence closes",
+			text: "~~~\n```\n```js\n~~~",
+			want: []Block{{}, {Code: true, Fence: "~~~", Lines: []string{"```", "```js"}}, {}},
+		},
+		{
+			name: "no info string on the closing fence",
+			text: "```\n```js\nfoo\n````",
+			want: []Block{{}, {Code: true, Fence: "```", Lines: []string{"```js", "foo"}}, {}},
+		},
+		{
+			name: "unclosed fence runs to the end",
+			text: "Log:\r\n```\npanic: boom",
+			want: []Block{{Lines: []string{"Log:"}}, {Code: true, Fence: "```", Lines: []string{"panic: boom"}}},
+		},
+	} {
+		if got := SplitBlocks(tc.text); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestNew_RejectsUnknownSteps(t *testing.T) {
+	if _, err := New(Options{Steps: []string{"stem"}}); err == nil {
+		t.Error("expected an error for an unknown step")
+	}
+	if _, err := New(Options{Boilerplate: []string{"("}}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestPipeline_NilLeavesTextUnchanged(t *testing.T) {
+	var p *Pipeline
+	if got := p.Normalize("<!-- x -->"); got != "<!-- x -->" {
+		t.Errorf("expected the text unchanged, got %q", got)
+	}
+}
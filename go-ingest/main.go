@@ -5,12 +5,18 @@ import (
 	"flag"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/zanmajeric/reporadar-go-ingest/api_server"
 	"github.com/zanmajeric/reporadar-go-ingest/config"
 	"github.com/zanmajeric/reporadar-go-ingest/embedder"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/indexer"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/ingest"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/jobs"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/repos"
 	"github.com/zanmajeric/reporadar-go-ingest/internal/search"
+	"github.com/zanmajeric/reporadar-go-ingest/internal/textnorm"
 )
 
 func main() {
@@ -31,10 +37,89 @@ func main() {
 	}
 	log.Println("Connected to Postgres")
 
-	embedderClient := embedder.NewClient(cfg.EmbedderUrl)
+	models, validators, err := embedder.ModelsFromConfig(cfg)
+	if err != nil {
+		log.Fatalf("failed to set up embedders: %v", err)
+	}
+	for _, v := range validators {
+		probeCtx, cancelProbe := context.WithTimeout(ctx, 10*time.Second)
+		if err := v.Probe(probeCtx); err != nil {
+			log.Printf("WARNING: %v, the dimension is learnt from the first vector", err)
+		}
+		cancelProbe()
+	}
+	// Search queries go through the query cache, the indexer embeds issues with the clients directly.
+	queryModels := models
+	var queryCaches map[string]*embedder.Cache
+	if !cfg.DisableQueryCache {
+		var store embedder.CacheStore
+		if cfg.QueryCachePersist {
+			store = embedder.NewPgCacheStore(pool)
+		}
+		queryModels, queryCaches = embedder.WithQueryCache(models, cfg.QueryCacheSize, cfg.QueryCacheTTL, store)
+	}
 	issueRep := search.NewPgRepository(pool)
-	searchSrv := search.New(embedderClient, issueRep, *cfg)
-	s := api_server.NewServer(cfg, pool, searchSrv)
+	for id, v := range validators {
+		dim := v.Status().Dim
+		if dim == 0 {
+			log.Printf("WARNING: dimension of model %s unknown, its vector index is created on the next start", id)
+			continue
+		}
+		if err := issueRep.EnsureVectorIndex(ctx, id, dim); err != nil {
+			log.Printf("WARNING: %v, vector searches of the model scan all of its chunks", err)
+		}
+	}
+	searchSrv := search.New(queryModels, issueRep, *cfg)
+	commentMode, err := indexer.ParseCommentMode(cfg.CommentEmbedding)
+	if err != nil {
+		log.Fatalf("failed to set up comment embedding: %v", err)
+	}
+	github := ingest.NewGithubSource(cfg.GithubApiUrl, cfg.GithubToken)
+	github.TimelineLimit = cfg.GithubTimelineLimit
+	jira := ingest.NewJiraSource(cfg.JiraUrl, cfg.JiraUser, cfg.JiraToken)
+	jira.Cloud = cfg.JiraCloud
+	ingestSrv := ingest.New(ingest.NewPgRepository(pool), map[string]ingest.Source{
+		"mock":   ingest.NewMockSource(cfg.MockIssuesFile),
+		"github": github,
+		"gitlab": ingest.NewGitlabSource(cfg.GitlabUrl, cfg.GitlabToken),
+		"jira":   jira,
+	}, ingest.Options{ReembedComments: commentMode != indexer.CommentsOff})
+	registry := repos.NewRegistry(repos.NewPgRepository(pool), ingestSrv.Modes(), models.Active)
+
+	normalizer, err := textnorm.New(textnorm.Options{
+		Steps:       cfg.TextNormSteps,
+		Boilerplate: cfg.TextNormBoilerplate,
+		LogHead:     cfg.TextNormLogHead,
+		LogTail:     cfg.TextNormLogTail,
+	})
+	if err != nil {
+		log.Fatalf("failed to set up text normalization: %v", err)
+	}
+	if cfg.DisableTextNorm {
+		normalizer = nil
+	}
+	indexOpts := indexer.Options{
+		BatchSize:    cfg.EmbedBatchSize,
+		PollInterval: cfg.EmbedPollInterval,
+		MaxAttempts:  cfg.EmbedMaxAttempts,
+		Lease:        cfg.EmbedLease,
+		RetryBackoff: cfg.EmbedRetryBackoff,
+		ChunkChars:   cfg.ChunkMaxChars,
+		Normalizer:   normalizer,
+		Comments:     commentMode,
+	}
+
+	jobRunner := jobs.NewRunner(jobs.NewPgRepository(pool), cfg.JobWorkers, cfg.JobPollInterval)
+	jobRunner.Register(ingest.JobKind, ingestSrv)
+	jobRunner.Register(indexer.ReindexJobKind, indexer.NewReindexer(indexer.NewPgRepository(pool), models, indexOpts))
+	go jobRunner.Run(ctx)
+
+	if !cfg.DisableEmbedWorker {
+		worker := indexer.NewWorker(indexer.NewPgRepository(pool), models, indexOpts)
+		go worker.Run(ctx)
+	}
+
+	s := api_server.NewServer(cfg, pool, searchSrv, ingestSrv, registry, jobRunner, queryCaches, validators)
 	log.Printf("Go ingest service listening on :%d", cfg.HttpPort)
 	s.Run()
 }
@@ -13,3 +13,21 @@ func EmbeddingToVectorLiteral(vec []float32) string {
 	// pgvector expects: [0.1,0.2,0.3]
 	return "[" + strings.Join(parts, ",") + "]"
 }
+
+// VectorLiteralToEmbedding parses the text form of a pgvector value, e.g. [0.1,0.2,0.3].
+func VectorLiteralToEmbedding(literal string) ([]float32, error) {
+	inner := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(literal), "["), "]")
+	if inner == "" {
+		return []float32{}, nil
+	}
+	parts := strings.Split(inner, ",")
+	vec := make([]float32, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 32)
+		if err != nil {
+			return nil, err
+		}
+		vec[i] = float32(v)
+	}
+	return vec, nil
+}
@@ -0,0 +1,24 @@
+package utils
+
+import "testing"
+
+func TestVectorLiteralRoundTrip(t *testing.T) {
+	vec := []float32{0.1, -0.25, 3}
+
+	got, err := VectorLiteralToEmbedding(EmbeddingToVectorLiteral(vec))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != len(vec) {
+		t.Fatalf("expected %d values, got %d", len(vec), len(got))
+	}
+	for i := range vec {
+		if got[i] != vec[i] {
+			t.Errorf("value %d: expected %v, got %v", i, vec[i], got[i])
+		}
+	}
+
+	if _, err := VectorLiteralToEmbedding("[0.1,abc]"); err == nil {
+		t.Error("expected an error for a malformed literal")
+	}
+}
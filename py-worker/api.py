@@ -1,8 +1,7 @@
 import os
-from typing import List
+from typing import List, Optional
 
 import psycopg2
-import worker
 from fastapi import FastAPI
 from psycopg2.extras import register_default_json
 from pydantic import BaseModel
@@ -28,6 +27,15 @@ def load_model() -> SentenceTransformer:
     return model
 
 
+def compute_embedding(text: str, model: SentenceTransformer) -> list[float]:
+    emb = model.encode(
+        text,
+        convert_to_numpy=True,
+        normalize_embeddings=True,
+    )
+    return emb.tolist()
+
+
 # Load once at startup
 model: SentenceTransformer | None = None
 
@@ -48,6 +56,16 @@ class EmbedResponse(BaseModel):
     embedding: List[float]
 
 
+class EmbedBatchRequest(BaseModel):
+    texts: List[str]
+
+
+class EmbedBatchResponse(BaseModel):
+    # One entry per text, failed items have no embedding and an error message instead.
+    embeddings: List[Optional[List[float]]]
+    errors: List[Optional[str]]
+
+
 @app.get("/health")
 def health():
     # Optional: ping DB as well
@@ -63,5 +81,26 @@ def health():
 def embed(req: EmbedRequest):
     if not req.text.strip():
         return EmbedResponse(embedding=[])
-    emb = worker.compute_embedding(req.text, model)
+    emb = compute_embedding(req.text, model)
     return EmbedResponse(embedding=emb)
+
+
+@app.post("/embed/batch", response_model=EmbedBatchResponse)
+def embed_batch(req: EmbedBatchRequest):
+    embeddings: List[Optional[List[float]]] = [None] * len(req.texts)
+    errors: List[Optional[str]] = [None] * len(req.texts)
+    valid = []
+    for i, text in enumerate(req.texts):
+        if text.strip():
+            valid.append(i)
+        else:
+            errors[i] = "empty text"
+    if valid:
+        embs = model.encode(
+            [req.texts[i] for i in valid],
+            convert_to_numpy=True,
+            normalize_embeddings=True,
+        )
+        for i, emb in zip(valid, embs):
+            embeddings[i] = emb.tolist()
+    return EmbedBatchResponse(embeddings=embeddings, errors=errors)
@@ -1,24 +1,192 @@
-
--- Create pgvector extension and issues table
+-- Create pgvector extension and issues table. This is the schema of fresh databases; upgrade.sql brings one created
+-- by an earlier version up to date, so columns added to existing tables have to be added there too.
 
 CREATE EXTENSION IF NOT EXISTS vector;
 
+-- Full-text document of an issue for the lexical search leg, title weighs most and body least. Declared immutable so
+-- it can back a generated column, it only depends on its arguments and the fixed 'english' configuration.
+CREATE OR REPLACE FUNCTION issue_search_document(title TEXT, body TEXT, keywords TEXT[])
+RETURNS tsvector LANGUAGE sql IMMUTABLE AS $$
+  SELECT setweight(to_tsvector('english', coalesce(title, '')), 'A')
+    || setweight(to_tsvector('english', coalesce(array_to_string(keywords, ' '), '')), 'B')
+    || setweight(to_tsvector('english', coalesce(body, '')), 'C')
+$$;
+
 CREATE TABLE IF NOT EXISTS issues (
   id TEXT PRIMARY KEY,
   repo TEXT NOT NULL,
+  number INTEGER,
   title TEXT NOT NULL,
   body TEXT,
+  -- Markup of body when it is not markdown, e.g. jira_wiki; the indexer converts it to plain text before embedding
+  body_format TEXT,
   labels TEXT[],
+  state TEXT,
+  author TEXT,
+  assignees TEXT[],
+  milestone TEXT,
   created_at TIMESTAMPTZ NOT NULL,
   updated_at TIMESTAMPTZ NOT NULL,
+  -- when and why a closed issue was closed: completed, not_planned or duplicate
+  closed_at TIMESTAMPTZ,
+  close_reason TEXT,
   keywords TEXT[],
-  embedding vector(384)
+  -- Body as it was embedded, after text normalization; cleared when the body changes
+  normalized_body TEXT,
+  -- Fingerprint of the first stack trace in the body, e.g. go:3f2a..., computed on ingest
+  stack_fingerprint TEXT,
+  -- Vectors of any dimension, embedding_model and embedding_dim tell which model produced them
+  embedding vector,
+  embedding_model TEXT,
+  embedding_dim INTEGER,
+  embed_attempts INTEGER NOT NULL DEFAULT 0,
+  embed_error TEXT,
+  embed_next_attempt_at TIMESTAMPTZ,
+  embed_claimed_until TIMESTAMPTZ,
+  deleted_at TIMESTAMPTZ,
+  search_tsv tsvector GENERATED ALWAYS AS (issue_search_document(title, COALESCE(normalized_body, body), keywords)) STORED
 );
 
 CREATE INDEX IF NOT EXISTS idx_issues_repo ON issues(repo);
 CREATE INDEX IF NOT EXISTS idx_issues_created ON issues(created_at);
-CREATE INDEX IF NOT EXISTS idx_issues_embedding
-  ON issues USING ivfflat (embedding vector_cosine_ops)
-  WITH (lists = 100);
-CREATE INDEX IF NOT EXISTS idx_issues_repo_embedding
-ON issues (repo, embedding);
+CREATE INDEX IF NOT EXISTS idx_issues_repo_created_id ON issues(repo, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_issues_repo_updated_id ON issues(repo, updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_issues_labels ON issues USING gin (labels);
+CREATE INDEX IF NOT EXISTS idx_issues_repo_embedding_model
+ON issues (repo, embedding_model);
+CREATE INDEX IF NOT EXISTS idx_issues_repo_stack_fingerprint ON issues(repo, stack_fingerprint)
+  WHERE stack_fingerprint IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_issues_search_tsv ON issues USING gin (search_tsv);
+CREATE INDEX IF NOT EXISTS idx_issues_pending_embedding ON issues(created_at)
+  WHERE embedding IS NULL AND deleted_at IS NULL;
+
+-- Chunks of issues, each embedded on its own so long bodies are searched in full. Vector search scores issues by
+-- their best matching chunks; only chunks of the model of issues.embedding are searched, others are leftovers of an
+-- earlier text or staged by a re-index job.
+CREATE TABLE IF NOT EXISTS issue_chunks (
+  issue_id TEXT NOT NULL,
+  model TEXT NOT NULL,
+  chunk_index INTEGER NOT NULL,
+  -- text, code or comment
+  kind TEXT NOT NULL,
+  text TEXT NOT NULL,
+  embedding vector NOT NULL,
+  -- the comment a chunk of kind comment is part of
+  comment_id TEXT,
+  PRIMARY KEY (issue_id, model, chunk_index)
+);
+-- ANN indexes need a fixed dimension, so the service creates one per model at startup once the model's dimension is
+-- known, on an expression that only serves queries using the same one:
+--   CREATE INDEX ON issue_chunks USING hnsw ((embedding::vector(384)) vector_ip_ops) WHERE model = 'reporadar';
+
+-- Comments of issues, embedded with them or in chunks of their own depending on CommentEmbedding
+CREATE TABLE IF NOT EXISTS comments (
+  id TEXT PRIMARY KEY,
+  issue_id TEXT NOT NULL,
+  repo TEXT NOT NULL,
+  author TEXT,
+  body TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_comments_issue_id ON comments (issue_id);
+
+-- Pull (or merge) requests, stored to link issues to their fixes
+CREATE TABLE IF NOT EXISTS pull_requests (
+  id TEXT PRIMARY KEY,
+  repo TEXT NOT NULL,
+  number INTEGER NOT NULL,
+  title TEXT NOT NULL,
+  body TEXT,
+  -- open, closed or merged
+  state TEXT NOT NULL,
+  author TEXT,
+  url TEXT,
+  created_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL,
+  merged_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_pull_requests_repo_number ON pull_requests (repo, number);
+
+-- Issues and the pull requests fixing them, by number as either side may be ingested first. source is reference
+-- ("fixes #123" in the pull request) or timeline (a cross-reference event of the issue)
+CREATE TABLE IF NOT EXISTS issue_pr_links (
+  repo TEXT NOT NULL,
+  issue_number INTEGER NOT NULL,
+  pr_number INTEGER NOT NULL,
+  source TEXT NOT NULL,
+  PRIMARY KEY (repo, issue_number, pr_number)
+);
+
+-- Incremental sync bookkeeping, one row per repo and ingest source
+CREATE TABLE IF NOT EXISTS repo_sync_state (
+  repo TEXT NOT NULL,
+  source TEXT NOT NULL,
+  last_updated_at TIMESTAMPTZ,
+  etag TEXT,
+  synced_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (repo, source)
+);
+
+-- Registered repositories, ingest and search refuse repos that are not listed here
+CREATE TABLE IF NOT EXISTS repos (
+  name TEXT PRIMARY KEY,
+  source TEXT NOT NULL,
+  settings JSONB NOT NULL DEFAULT '{}',
+  webhook_secret TEXT,
+  -- Model of the vectors the repo is searched with, changed by the switch-over at the end of a re-index
+  embedding_model TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Background jobs (ingest, ...) processed by the worker pool of the Go service
+CREATE TABLE IF NOT EXISTS jobs (
+  id BIGSERIAL PRIMARY KEY,
+  kind TEXT NOT NULL,
+  repo TEXT NOT NULL,
+  params JSONB NOT NULL DEFAULT '{}',
+  state TEXT NOT NULL DEFAULT 'queued',
+  stats JSONB NOT NULL DEFAULT '{}',
+  error TEXT,
+  cancel_requested BOOLEAN NOT NULL DEFAULT false,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  started_at TIMESTAMPTZ,
+  finished_at TIMESTAMPTZ,
+  heartbeat_at TIMESTAMPTZ,
+  -- Incremented by every claim, a worker only updates the job while it holds the latest claim
+  claim_token BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_state ON jobs(state, created_at);
+-- At most one queued job per kind, repo and params, enqueueing it again returns the queued one
+CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_queued ON jobs(kind, repo, params) WHERE state = 'queued';
+
+-- Processed GitHub webhook deliveries, replays of the same X-GitHub-Delivery are ignored
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  delivery_id TEXT PRIMARY KEY,
+  repo TEXT NOT NULL,
+  event TEXT NOT NULL,
+  action TEXT,
+  received_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Embeddings of search queries, shared by the replicas of the Go service
+CREATE TABLE IF NOT EXISTS query_embedding_cache (
+  model TEXT NOT NULL,
+  query TEXT NOT NULL,
+  embedding vector NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY (model, query)
+);
+
+-- Vectors computed by a re-index job for a model the repo does not use yet. They replace issues.embedding in one
+-- transaction once every issue of the repo has an up-to-date row.
+CREATE TABLE IF NOT EXISTS issue_embeddings (
+  issue_id TEXT NOT NULL,
+  model TEXT NOT NULL,
+  dim INTEGER NOT NULL,
+  embedding vector NOT NULL,
+  -- updated_at of the issue the vector was computed from
+  source_updated_at TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY (issue_id, model)
+);
@@ -0,0 +1,62 @@
+-- Upgrades a database created from an earlier sql/init.sql to the current schema, applies init.sql for the tables and
+-- indexes added since and queues the issues embedded without chunks to be embedded again. Idempotent, so it can be
+-- run on any earlier version (and again):
+--   psql -v ON_ERROR_STOP=1 -f sql/upgrade.sql
+-- Fresh installs only need init.sql.
+
+BEGIN;
+
+CREATE EXTENSION IF NOT EXISTS vector;
+
+CREATE OR REPLACE FUNCTION issue_search_document(title TEXT, body TEXT, keywords TEXT[])
+RETURNS tsvector LANGUAGE sql IMMUTABLE AS $$
+  SELECT setweight(to_tsvector('english', coalesce(title, '')), 'A')
+    || setweight(to_tsvector('english', coalesce(array_to_string(keywords, ' '), '')), 'B')
+    || setweight(to_tsvector('english', coalesce(body, '')), 'C')
+$$;
+
+-- The first schema indexed embeddings of a fixed dimension; vectors are now searched by chunk, through the per-model
+-- HNSW indexes on issue_chunks the service creates at startup.
+DROP INDEX IF EXISTS idx_issues_embedding;
+DROP INDEX IF EXISTS idx_issues_repo_embedding;
+
+ALTER TABLE IF EXISTS issues
+  ALTER COLUMN embedding TYPE vector,
+  ADD COLUMN IF NOT EXISTS number INTEGER,
+  ADD COLUMN IF NOT EXISTS body_format TEXT,
+  ADD COLUMN IF NOT EXISTS state TEXT,
+  ADD COLUMN IF NOT EXISTS author TEXT,
+  ADD COLUMN IF NOT EXISTS assignees TEXT[],
+  ADD COLUMN IF NOT EXISTS milestone TEXT,
+  ADD COLUMN IF NOT EXISTS closed_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS close_reason TEXT,
+  ADD COLUMN IF NOT EXISTS normalized_body TEXT,
+  ADD COLUMN IF NOT EXISTS stack_fingerprint TEXT,
+  ADD COLUMN IF NOT EXISTS embedding_model TEXT,
+  ADD COLUMN IF NOT EXISTS embedding_dim INTEGER,
+  ADD COLUMN IF NOT EXISTS embed_attempts INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS embed_error TEXT,
+  ADD COLUMN IF NOT EXISTS embed_next_attempt_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS embed_claimed_until TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS search_tsv tsvector
+    GENERATED ALWAYS AS (issue_search_document(title, COALESCE(normalized_body, body), keywords)) STORED;
+
+ALTER TABLE IF EXISTS jobs
+  ADD COLUMN IF NOT EXISTS claim_token BIGINT NOT NULL DEFAULT 0;
+
+COMMIT;
+
+\ir init.sql
+
+-- Vector search only reads issue_chunks. Embeddings stored without chunks of their model, by earlier versions or the
+-- old Python batch worker, are cleared so the embed worker embeds these issues again, in chunks.
+UPDATE issues i SET
+  embedding = NULL,
+  embedding_model = NULL,
+  embedding_dim = NULL,
+  embed_attempts = 0,
+  embed_error = NULL,
+  embed_next_attempt_at = NULL
+WHERE i.embedding IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM issue_chunks c WHERE c.issue_id = i.id AND c.model = i.embedding_model);